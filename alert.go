@@ -0,0 +1,296 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notifier delivers alerts, e.g. by e-mail or to a chat webhook.
+type Notifier interface {
+	Notify(subject, body string) error
+}
+
+// AlertConfig configures an AlertHandler.
+type AlertConfig struct {
+	// Subject is prepended to the subject of every alert, e.g. "[myapp]".
+	Subject string
+	// Formatter formats the entries listed in the body of an alert.
+	Formatter Formatter
+	// DigestDelay is the time an alert is delayed after its first entry, so
+	// that entries logged in the meantime are sent as a single digest.
+	DigestDelay time.Duration
+	// MaxDigestEntries limits the number of entries listed in a digest, all
+	// others are only counted. 0 means no limit.
+	MaxDigestEntries int
+	// ThrottleInterval is the minimum time between alerts for entries logged
+	// from the same call site. Entries logged from it in the meantime are
+	// only counted, and the count is sent with the next digest or once the
+	// interval has passed. Entries without a stack are throttled per level.
+	ThrottleInterval time.Duration
+	ErrorHandler     ErrorHandler
+}
+
+// NewAlertHandler returns an *AlertHandler that sends alerts using notifier.
+// A nil Formatter is replaced with the one of DefaultAlertConfig.
+func NewAlertHandler(notifier Notifier, config AlertConfig) *AlertHandler {
+	if config.Formatter == nil {
+		config.Formatter = DefaultAlertConfig.Formatter
+	}
+	return &AlertHandler{
+		config:     config,
+		notifier:   notifier,
+		now:        time.Now,
+		suppressed: map[string]int{},
+		lastAlert:  map[string]time.Time{},
+	}
+}
+
+// AlertHandler is a Handler that notifies somebody about the entries it
+// receives. It is meant to be registered for the ERROR level and above, e.g.
+//
+//	logger.Handle(ERROR, NewAlertHandler(notifier, DefaultAlertConfig))
+//
+// Bursts of entries are coalesced into digests, and repeated entries from the
+// same call site are throttled, so a failing dependency does not cause
+// thousands of alerts.
+type AlertHandler struct {
+	config   AlertConfig
+	notifier Notifier
+	now      func() time.Time
+
+	mu sync.Mutex
+	// pending holds the entries of the next digest, suppressed the number of
+	// throttled entries per call site and lastAlert the time of the last alert
+	// per call site. timer sends the digest at due, which is config.DigestDelay
+	// after the first pending entry, or the end of the throttle interval of
+	// a call site with suppressed entries if that is earlier.
+	pending    []Entry
+	suppressed map[string]int
+	lastAlert  map[string]time.Time
+	timer      *time.Timer
+	due        time.Time
+	closed     bool
+	// sending serializes calls to the notifier.
+	sending sync.Mutex
+}
+
+func (h *AlertHandler) Log(e Entry) {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		h.error(ErrClosed)
+		return
+	}
+	defer h.mu.Unlock()
+
+	site := callSite(e)
+	now := h.now()
+	if last, ok := h.lastAlert[site]; ok && now.Sub(last) < h.config.ThrottleInterval {
+		h.suppressed[site]++
+		h.schedule(now, last.Add(h.config.ThrottleInterval))
+		return
+	}
+	// Call sites whose interval has passed are forgotten, so lastAlert only
+	// holds the call sites that alerted recently.
+	for s, last := range h.lastAlert {
+		if now.Sub(last) >= h.config.ThrottleInterval {
+			delete(h.lastAlert, s)
+		}
+	}
+	h.lastAlert[site] = now
+	h.pending = append(h.pending, e)
+	h.schedule(now, now.Add(h.config.DigestDelay))
+}
+
+// schedule makes the timer send the digest at the given time, unless it is
+// due earlier already. h.mu must be held.
+func (h *AlertHandler) schedule(now, at time.Time) {
+	if h.timer != nil {
+		if !at.Before(h.due) {
+			return
+		}
+		h.timer.Stop()
+	}
+	h.due = at
+	h.timer = time.AfterFunc(at.Sub(now), h.send)
+}
+
+// Flush sends the pending digest immediately, including the counts of
+// throttled entries, and waits until it was sent.
+func (h *AlertHandler) Flush() {
+	h.send()
+}
+
+// Close sends the pending digest like Flush. Entries logged after Close are
+// reported as ErrClosed to the ErrorHandler.
+func (h *AlertHandler) Close() error {
+	h.mu.Lock()
+	h.closed = true
+	h.mu.Unlock()
+	h.send()
+	return nil
+}
+
+// send passes the pending digest to the notifier.
+func (h *AlertHandler) send() {
+	h.sending.Lock()
+	defer h.sending.Unlock()
+
+	h.mu.Lock()
+	pending, suppressed := h.pending, h.suppressed
+	h.pending, h.suppressed = nil, map[string]int{}
+	if h.timer != nil {
+		h.timer.Stop()
+		h.timer = nil
+	}
+	// Sending the counts of throttled call sites starts their next interval.
+	now := h.now()
+	for site := range suppressed {
+		h.lastAlert[site] = now
+	}
+	h.mu.Unlock()
+
+	if len(pending) == 0 && len(suppressed) == 0 {
+		return
+	}
+	if err := h.notifier.Notify(h.digest(pending, suppressed)); err != nil {
+		h.error(err)
+	}
+}
+
+// digest returns the subject and body of an alert for the given entries and
+// counts of throttled entries.
+func (h *AlertHandler) digest(pending []Entry, suppressed map[string]int) (string, string) {
+	subject := h.config.Subject
+	if subject != "" {
+		subject += " "
+	}
+	if len(pending) > 0 {
+		subject += strings.ToUpper(pending[0].Level.String()) + ": " + pending[0].Message
+		if len(pending) > 1 {
+			subject += fmt.Sprintf(" (+%d more)", len(pending)-1)
+		}
+	} else {
+		subject += "Repeated alerts"
+	}
+
+	body := &bytes.Buffer{}
+	for i, e := range pending {
+		if h.config.MaxDigestEntries > 0 && i >= h.config.MaxDigestEntries {
+			fmt.Fprintf(body, "... and %d more entries.\n", len(pending)-i)
+			break
+		}
+		body.WriteString(h.config.Formatter.Format(e))
+	}
+	if len(suppressed) > 0 {
+		sites := make([]string, 0, len(suppressed))
+		for site := range suppressed {
+			sites = append(sites, site)
+		}
+		sort.Strings(sites)
+		if body.Len() > 0 {
+			body.WriteByte('\n')
+		}
+		body.WriteString("Throttled entries:\n")
+		for _, site := range sites {
+			fmt.Fprintf(body, "%d from %s\n", suppressed[site], site)
+		}
+	}
+	return subject, body.String()
+}
+
+// callSite returns the file and line an entry was logged from. Entries without
+// a stack share one call site per level, as their messages may contain ids.
+func callSite(e Entry) string {
+	if len(e.Stack) == 0 {
+		return "unknown " + e.Level.String() + " call site"
+	}
+	return filepath.Base(e.File()) + ":" + strconv.Itoa(e.Line())
+}
+
+func (h *AlertHandler) error(err error) {
+	if h.config.ErrorHandler != nil {
+		h.config.ErrorHandler(err)
+	}
+}
+
+// SMTPNotifier sends alerts as plain text e-mails using net/smtp.
+type SMTPNotifier struct {
+	// Addr is the address of the mail server, e.g. "mail.example.com:25".
+	Addr string
+	// Auth is optional, see smtp.PlainAuth.
+	Auth smtp.Auth
+	From string
+	To   []string
+	// sendMail is smtp.SendMail if it is nil.
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func (n *SMTPNotifier) Notify(subject, body string) error {
+	// Entries may contain arbitrary characters, so newlines are removed from
+	// the subject to prevent them from adding headers.
+	subject = strings.Join(strings.Fields(subject), " ")
+	msg := &bytes.Buffer{}
+	fmt.Fprintf(msg, "From: %s\r\n", n.From)
+	fmt.Fprintf(msg, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+
+	sendMail := n.sendMail
+	if sendMail == nil {
+		sendMail = smtp.SendMail
+	}
+	return sendMail(n.Addr, n.Auth, n.From, n.To, msg.Bytes())
+}
+
+// WebhookNotifier sends alerts as JSON objects with "subject" and "text"
+// properties to a URL, e.g. a chat webhook.
+type WebhookNotifier struct {
+	URL string
+	// Header holds additional request headers, e.g. for authentication.
+	Header http.Header
+	// Client sends the requests. http.DefaultClient is used if it is nil.
+	Client *http.Client
+}
+
+func (n *WebhookNotifier) Notify(subject, body string) error {
+	data, err := json.Marshal(map[string]string{"subject": subject, "text": body})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", n.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for key, values := range n.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("POST %s returned %s.", n.URL, resp.Status)
+	}
+	return nil
+}
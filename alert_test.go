@@ -0,0 +1,196 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// alertRecorder is a Notifier that records the alerts it receives.
+type alertRecorder struct {
+	mu     sync.Mutex
+	alerts [][2]string
+}
+
+func (r *alertRecorder) Notify(subject, body string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.alerts = append(r.alerts, [2]string{subject, body})
+	return nil
+}
+
+func (r *alertRecorder) Alerts() [][2]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][2]string(nil), r.alerts...)
+}
+
+func TestAlertHandler(t *testing.T) {
+	var (
+		r      = &alertRecorder{}
+		now    = time.Date(2014, 1, 2, 3, 4, 5, 0, time.UTC)
+		config = DefaultAlertConfig
+	)
+	config.Subject = "[test]"
+	config.Formatter = DefaultMessageFormatter
+	config.DigestDelay = time.Hour
+	h := NewAlertHandler(r, config)
+	h.now = func() time.Time { return now }
+	l := NewLogger(DefaultConfig)
+	l.Handle(ERROR, h)
+
+	l.Warn("ignored")
+	var line int
+	for i := 0; i < 3; i++ {
+		_, _, line, _ = runtime.Caller(0)
+		l.Error("db down %d", i)
+	}
+	l.Error("other")
+	l.Flush()
+
+	site := "alert_test.go:" + strconv.Itoa(line+1)
+	alerts := r.Alerts()
+	if len(alerts) != 1 || alerts[0][0] != "[test] ERROR: db down 0 (+1 more)" {
+		t.Fatalf("Bad alerts: %q", alerts)
+	}
+	if body := alerts[0][1]; body != "db down 0\nother\n\nThrottled entries:\n2 from "+site+"\n" {
+		t.Errorf("Bad body: %q", body)
+	}
+
+	// After the throttle interval, the call site alerts again.
+	now = now.Add(time.Hour)
+	h.config.DigestDelay = time.Millisecond
+	l.Error("db down %d", 3)
+	for i := 0; len(r.Alerts()) != 2; i++ {
+		if i > 1000 {
+			t.Fatal("Digest was not sent")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if alert := r.Alerts()[1]; alert[0] != "[test] ERROR: db down 3" {
+		t.Errorf("Bad alert: %q", alert)
+	}
+
+	// Throttled entries are only sent once the throttle interval of their
+	// call site has passed, no matter how often they are logged.
+	h.now = time.Now
+	h.config.ThrottleInterval = 200 * time.Millisecond
+	start := time.Now()
+	h.Log(NewEntry(ERROR, "job %d failed", 1))
+	for i := 0; len(r.Alerts()) != 3; i++ {
+		if i > 1000 {
+			t.Fatal("Digest was not sent")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for i := 2; i <= 10; i++ {
+		h.Log(NewEntry(ERROR, "job %d failed", i))
+	}
+	time.Sleep(50 * time.Millisecond)
+	if alerts := r.Alerts(); len(alerts) != 3 || alerts[2][0] != "[test] ERROR: job 1 failed" {
+		t.Fatalf("Bad alerts: %q", alerts)
+	}
+	for i := 0; len(r.Alerts()) != 4; i++ {
+		if i > 1000 {
+			t.Fatal("Digest was not sent")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if elapsed := time.Since(start); elapsed < h.config.ThrottleInterval {
+		t.Errorf("Throttled entries were sent after %s", elapsed)
+	}
+	if alert := r.Alerts()[3]; alert[0] != "[test] Repeated alerts" || alert[1] != "Throttled entries:\n9 from unknown error call site\n" {
+		t.Errorf("Bad alert: %q", alert)
+	}
+	// Call sites are forgotten once their throttle interval has passed.
+	h.mu.Lock()
+	sites := len(h.lastAlert)
+	h.mu.Unlock()
+	if sites != 1 {
+		t.Errorf("Bad #sites: %d", sites)
+	}
+
+	errs := &errorRecorder{}
+	h.config.ErrorHandler = errs.Handle
+	h.Close()
+	h.Log(NewEntry(ERROR, "closed"))
+	if errors := errs.Errors(); len(errors) != 1 || errors[0] != ErrClosed {
+		t.Errorf("Bad errors: %v", errors)
+	}
+}
+
+func TestAlertHandler_maxDigestEntries(t *testing.T) {
+	r := &alertRecorder{}
+	config := DefaultAlertConfig
+	config.Formatter = DefaultMessageFormatter
+	config.MaxDigestEntries = 2
+	config.ThrottleInterval = 0
+	h := NewAlertHandler(r, config)
+	for i := 0; i < 5; i++ {
+		h.Log(NewEntry(ERROR, "%d", i))
+	}
+	h.Flush()
+	if alerts := r.Alerts(); len(alerts) != 1 || alerts[0][1] != "0\n1\n... and 3 more entries.\n" {
+		t.Errorf("Bad alerts: %q", alerts)
+	}
+}
+
+func TestAlertHandler_zeroConfig(t *testing.T) {
+	r := &alertRecorder{}
+	h := NewAlertHandler(r, AlertConfig{})
+	h.Log(NewEntry(ERROR, "A"))
+	h.Flush()
+	if alerts := r.Alerts(); len(alerts) != 1 || !strings.Contains(alerts[0][1], "[error] A") {
+		t.Errorf("Bad alerts: %q", alerts)
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	var sent []byte
+	n := &SMTPNotifier{Addr: "mail:25", From: "log@example.com", To: []string{"a@example.com", "b@example.com"}}
+	n.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		if addr != n.Addr || from != n.From || len(to) != 2 {
+			t.Errorf("Bad arguments: %s %s %v", addr, from, to)
+		}
+		sent = msg
+		return nil
+	}
+	if err := n.Notify("ERROR: oh\r\nBcc: x@example.com", "line 1\nline 2\n"); err != nil {
+		t.Fatal(err)
+	}
+	expected := "From: log@example.com\r\nTo: a@example.com, b@example.com\r\n" +
+		"Subject: ERROR: oh Bcc: x@example.com\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n\r\nline 1\r\nline 2\r\n"
+	if string(sent) != expected {
+		t.Errorf("Bad message:\n%q\n%q", sent, expected)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var got map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		json.NewDecoder(req.Body).Decode(&got)
+		if strings.Contains(got["text"], "fail") {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	n := &WebhookNotifier{URL: server.URL}
+	if err := n.Notify("A", "B"); err != nil {
+		t.Fatal(err)
+	}
+	if got["subject"] != "A" || got["text"] != "B" {
+		t.Errorf("Bad request: %v", got)
+	}
+	if err := n.Notify("A", "fail"); err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("Bad error: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package log
+
+// AsyncConfig configures an AsyncHandler.
+type AsyncConfig struct {
+	// QueueConfig configures the queue of entries waiting to be passed to the
+	// wrapped handler. Spill is not supported.
+	QueueConfig
+	ErrorHandler ErrorHandler
+}
+
+// NewAsyncHandler returns an *AsyncHandler that passes entries to handler
+// from a background goroutine. If config.Spill is set, an error is reported
+// to the ErrorHandler and entries are only queued in memory.
+func NewAsyncHandler(handler Handler, config AsyncConfig) *AsyncHandler {
+	a := &AsyncHandler{config: config, handler: handler}
+	queueConfig := config.QueueConfig
+	if queueConfig.Spill.Dir != "" {
+		a.error(invalidConfig("AsyncConfig", "Spill is not supported"))
+		queueConfig.Spill = SpillConfig{}
+	}
+	// Without a spill, opening the queue can not fail.
+	a.queue, _ = newQueueFromConfig(queueConfig, a, a.error)
+	return a
+}
+
+// AsyncHandler decouples a Handler from its callers by queuing entries in a
+// bounded queue that is processed by a background goroutine.
+type AsyncHandler struct {
+	config  AsyncConfig
+	handler Handler
+	queue   *queue
+}
+
+// Log queues the given Entry.
+func (a *AsyncHandler) Log(e Entry) {
+	a.queue.push(e, e)
+}
+
+// Flush waits until all queued entries have been passed to the wrapped
+// handler and its Flush method has returned.
+func (a *AsyncHandler) Flush() {
+	a.queue.flush()
+}
+
+// Close processes all queued entries, stops the background goroutine and
+// closes the wrapped handler if it implements Closer, or flushes it otherwise.
+func (a *AsyncHandler) Close() error {
+	return a.queue.close()
+}
+
+// Name returns the name of the wrapped handler.
+func (a *AsyncHandler) Name() string {
+	return "AsyncHandler(" + HandlerName(a.handler) + ")"
+}
+
+func (a *AsyncHandler) handleOp(op interface{}) {
+	a.handler.Log(op.(Entry))
+}
+
+func (a *AsyncHandler) handleFlush() {
+	a.handler.Flush()
+}
+
+func (a *AsyncHandler) handleClose() error {
+	if closer, ok := a.handler.(Closer); ok {
+		return closer.Close()
+	}
+	a.handler.Flush()
+	return nil
+}
+
+func (a *AsyncHandler) error(err error) {
+	if a.config.ErrorHandler != nil {
+		a.config.ErrorHandler(err)
+	}
+}
@@ -0,0 +1,149 @@
+package log
+
+import (
+	"testing"
+	"time"
+)
+
+// closeHandler is a *TestHandler that records calls to Close.
+type closeHandler struct {
+	*TestHandler
+	closed bool
+}
+
+func (h *closeHandler) Close() error {
+	h.closed = true
+	return nil
+}
+
+func TestAsyncHandler(t *testing.T) {
+	var (
+		errs    = &errorRecorder{}
+		b       = &blockingHandler{release: make(chan struct{}), entered: make(chan struct{}, 1)}
+		w       = &closeHandler{TestHandler: NewTestHandler()}
+		config  = AsyncConfig{QueueConfig: QueueConfig{Capacity: 1}, ErrorHandler: errs.Handle}
+		blocked = NewAsyncHandler(b, config)
+		a       = NewAsyncHandler(w, config)
+	)
+
+	a.Log(NewEntry(INFO, "A"))
+	a.Flush()
+	if !w.MatchLevel("^A$", INFO) {
+		t.Errorf("Missing entry: A")
+	}
+	if err := a.Close(); err != nil || !w.closed {
+		t.Errorf("Close failed: %v", err)
+	}
+	a.Log(NewEntry(INFO, "B"))
+	if len(w.Entries) != 1 {
+		t.Errorf("Logged after Close")
+	}
+
+	// The flush request blocks the goroutine of the queue, so the first entry
+	// fills the queue and the second one is dropped.
+	go blocked.Flush()
+	<-b.entered
+	blocked.Log(NewEntry(INFO, "C"))
+	blocked.Log(NewEntry(INFO, "D"))
+	close(b.release)
+	blocked.Close()
+
+	errors := errs.Errors()
+	if len(errors) != 2 || errors[0] != ErrClosed {
+		t.Fatalf("Bad errors: %v", errors)
+	}
+	if dropped, ok := errors[1].(*ErrEntryDropped); !ok || dropped.Entry.Message != "D" {
+		t.Errorf("Bad error: %#v", errors[1])
+	}
+	if name := blocked.Name(); name != "AsyncHandler(blocking)" {
+		t.Errorf("Bad name: %s", name)
+	}
+}
+
+// gateHandler is a *TestHandler whose Flush blocks like a *blockingHandler.
+type gateHandler struct {
+	*TestHandler
+	gate *blockingHandler
+}
+
+func (h *gateHandler) Flush() {
+	h.gate.Flush()
+}
+
+func TestAsyncHandler_overflow(t *testing.T) {
+	tests := []struct {
+		config  AsyncConfig
+		levels  []Level
+		dropped string
+		logged  string
+		reports []error
+	}{
+		{
+			config:  AsyncConfig{QueueConfig: QueueConfig{Capacity: 2}},
+			levels:  []Level{INFO, INFO, INFO},
+			dropped: "2",
+			logged:  "01",
+		},
+		{
+			config:  AsyncConfig{QueueConfig: QueueConfig{Capacity: 2, Overflow: OverflowDropOldest}},
+			levels:  []Level{INFO, INFO, INFO},
+			dropped: "0",
+			logged:  "12",
+		},
+		{
+			config:  AsyncConfig{QueueConfig: QueueConfig{Capacity: 1, Overflow: OverflowBlockTimeout, BlockTimeout: time.Millisecond}},
+			levels:  []Level{INFO, INFO},
+			dropped: "1",
+			logged:  "0",
+		},
+		{
+			config:  AsyncConfig{QueueConfig: QueueConfig{Capacity: 2, Overflow: OverflowDropByLevel}},
+			levels:  []Level{DEBUG, INFO, INFO, DEBUG, ERROR, PANIC},
+			dropped: "0312",
+			logged:  "45",
+		},
+		{
+			config:  AsyncConfig{QueueConfig: QueueConfig{Capacity: 1, DropReportInterval: time.Hour}},
+			levels:  []Level{INFO, INFO, INFO},
+			logged:  "0",
+			reports: []error{&ErrEntriesDropped{Count: 2, Interval: time.Hour}},
+		},
+	}
+
+	for i, test := range tests {
+		var (
+			errs = &errorRecorder{}
+			gate = &blockingHandler{release: make(chan struct{}), entered: make(chan struct{}, 1)}
+			h    = &gateHandler{TestHandler: NewTestHandler(), gate: gate}
+		)
+		test.config.ErrorHandler = errs.Handle
+		a := NewAsyncHandler(h, test.config)
+		go a.Flush()
+		<-gate.entered
+
+		for j, lvl := range test.levels {
+			a.Log(NewEntry(lvl, "%d", j))
+		}
+		close(gate.release)
+		a.Close()
+
+		dropped := ""
+		for _, err := range errs.Errors() {
+			if dropErr, ok := err.(*ErrEntryDropped); ok {
+				dropped += dropErr.Entry.Message
+			} else if len(test.reports) == 0 || err.Error() != test.reports[0].Error() {
+				t.Errorf("test %d: Unexpected error: %s", i, err)
+			}
+		}
+		if dropped != test.dropped {
+			t.Errorf("test %d: Bad dropped entries: %q != %q", i, dropped, test.dropped)
+		}
+		logged := ""
+		for _, e := range h.Entries {
+			logged += e.Message
+		}
+		if logged != test.logged {
+			t.Errorf("test %d: Bad logged entries: %q != %q", i, logged, test.logged)
+		}
+	}
+}
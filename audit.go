@@ -0,0 +1,70 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	ErrNoDurableHandler = errors.New("No durable handler registered for entry.")
+	ErrNotDurable       = errors.New("Entry was written to a stream that can not be synced.")
+)
+
+// DurableHandler is implemented by handlers that can report if an entry was
+// stored durably, e.g. *FileWriter. It is used by Logger.Audit.
+type DurableHandler interface {
+	Handler
+	// LogDurable is like Log, but only returns once the entry was stored
+	// durably, or returns an error if it was not.
+	LogDurable(Entry) error
+}
+
+// Audit logs an entry at the given level that must not be lost, e.g. a
+// compliance event. Unlike the other log methods, it waits for all
+// DurableHandlers registered for lvl to store the entry and returns an error
+// if any of them failed or none is registered. In that case the event should
+// be considered not logged. Other handlers receive the entry via Log as usual.
+func (l *Logger) Audit(lvl Level, args ...interface{}) error {
+	return l.LogDurable(NewEntryWithStack(lvl, 3, 1, args...))
+}
+
+// LogDurable is like Log, but calls LogDurable on handlers implementing
+// DurableHandler, see Audit.
+func (l *Logger) LogDurable(e Entry) error {
+	if l.root != nil {
+		e.Fields = l.fields.Merge(e.Fields)
+		l = l.root
+	}
+
+	var durable []DurableHandler
+	for _, h := range l.getHandlers() {
+		if e.Level < h.lvl {
+			continue
+		}
+		if d, ok := h.handler.(DurableHandler); ok {
+			durable = append(durable, d)
+		} else {
+			h.handler.Log(e)
+		}
+	}
+	if len(durable) == 0 {
+		return ErrNoDurableHandler
+	}
+
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(durable))
+	)
+	for i, h := range durable {
+		wg.Add(1)
+		go func(i int, h DurableHandler) {
+			defer wg.Done()
+			if err := h.LogDurable(e); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", HandlerName(h), err)
+			}
+		}(i, h)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
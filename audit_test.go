@@ -0,0 +1,92 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogger_Audit(t *testing.T) {
+	var (
+		dir    = t.TempDir()
+		config = DefaultFileWriterConfig
+		h      = NewTestHandler()
+	)
+	config.Path = filepath.Join(dir, "audit.log")
+	config.Formatter = DefaultMessageFormatter
+	config.ErrorHandler = nil
+	config.RotateSignal = nil
+
+	l := NewLogger(DefaultConfig, h)
+	if err := l.Audit(INFO, "A"); err != ErrNoDurableHandler {
+		t.Errorf("Bad error: %v", err)
+	}
+
+	w := NewFileWriterConfig(config)
+	l.Handle(INFO, w)
+	if err := l.With(Context{"user": 1}).Audit(INFO, "B"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(config.Path); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "B user=1\n" {
+		t.Errorf("Bad data: %q", data)
+	}
+	if !h.MatchLevel("^B user=1$", INFO) {
+		t.Errorf("Missing entry: B")
+	}
+	if err := l.Audit(DEBUG, "C"); err != ErrNoDurableHandler {
+		t.Errorf("Bad error: %v", err)
+	}
+
+	w.Close()
+	if err := l.Audit(INFO, "D"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Bad error: %v", err)
+	}
+
+	// Streams like os.Stdout can not be synced, while a regular file passed
+	// as Writer can.
+	r, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer pw.Close()
+	file, err := os.Create(filepath.Join(dir, "writer.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	for _, test := range []struct {
+		writer io.Writer
+		err    error
+	}{
+		{&bytes.Buffer{}, ErrNotDurable},
+		{pw, ErrNotDurable},
+		{file, nil},
+	} {
+		writerConfig := DefaultFileWriterConfig
+		writerConfig.Writer = test.writer
+		writerConfig.ErrorHandler = nil
+		writerConfig.RotateSignal = nil
+		w = NewFileWriterConfig(writerConfig)
+		l.ReplaceHandlers(DEBUG, w)
+		if err := l.Audit(INFO, "D"); !errors.Is(err, test.err) {
+			t.Errorf("Bad error for %T: %v", test.writer, err)
+		}
+		w.Close()
+	}
+
+	config.Path = filepath.Join(dir, "missing", "audit.log")
+	w = NewFileWriterConfig(config)
+	defer w.Close()
+	l.ReplaceHandlers(DEBUG, w)
+	err = l.Audit(INFO, "E")
+	if err == nil || !strings.HasPrefix(err.Error(), "FileWriter("+config.Path+"): ") {
+		t.Errorf("Bad error: %v", err)
+	}
+}
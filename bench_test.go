@@ -49,6 +49,17 @@ func BenchmarkDiscardLineLogger(b *testing.B) {
 	b.Logf("%s (%d ops in %s)", hz, total, duration)
 }
 
+// BenchmarkDisabledLevel benchmarks the overhead of log calls below the level
+// of all handlers.
+func BenchmarkDisabledLevel(b *testing.B) {
+	l := NewLogger(DefaultConfig)
+	l.Handle(INFO, NewTestHandler())
+
+	for i := 0; i < b.N; i++ {
+		l.Debug("Hello %s", "World")
+	}
+}
+
 var prefixes = map[int]string{
 	1000:    "k",
 	1000000: "M",
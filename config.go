@@ -0,0 +1,49 @@
+package log
+
+import (
+	"fmt"
+	"time"
+)
+
+// configSetting is a numeric setting of a config, see validateNonNegative.
+type configSetting struct {
+	name string
+	val  int64
+}
+
+// validateNonNegative returns an error for the first of settings that is
+// negative, or nil. config is the name of the config type.
+func validateNonNegative(config string, settings ...configSetting) error {
+	for _, setting := range settings {
+		if setting.val < 0 {
+			return invalidConfig(config, "%s must not be negative", setting.name)
+		}
+	}
+	return nil
+}
+
+// validateRetry returns an error if maxInterval is set and less than
+// interval, or nil.
+func validateRetry(config string, interval, maxInterval time.Duration) error {
+	if maxInterval > 0 && maxInterval < interval {
+		return invalidConfig(config, "MaxRetryInterval must not be less than RetryInterval")
+	}
+	return nil
+}
+
+func invalidConfig(config string, format string, args ...interface{}) error {
+	return fmt.Errorf("Invalid "+config+": "+format+".", args...)
+}
+
+// backoff returns the delay before the next attempt after one failed, given
+// the current delay, which is 0 after a success. The delay starts at interval
+// and is doubled after every failed attempt, up to maxInterval unless it is 0.
+func backoff(delay, interval, maxInterval time.Duration) time.Duration {
+	if delay == 0 {
+		return interval
+	}
+	if delay *= 2; maxInterval > 0 && delay > maxInterval {
+		return maxInterval
+	}
+	return delay
+}
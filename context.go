@@ -1,3 +1,74 @@
 package log
 
+import (
+	"sort"
+)
+
+// Context holds key/value pairs that can be passed as an argument to any log
+// call, e.g. log.Info("User login", log.Context{"user_id": 23}).
 type Context map[string]interface{}
+
+// Fields returns the key/value pairs of c sorted by key.
+func (c Context) Fields() Fields {
+	fields := make(Fields, 0, len(c))
+	for key, val := range c {
+		fields = append(fields, Field{Key: key, Value: val})
+	}
+	sort.Sort(fields)
+	return fields
+}
+
+// Field is a single key/value pair of a Fields collection.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Fields is an ordered collection of key/value pairs with unique keys.
+type Fields []Field
+
+func (f Fields) Len() int {
+	return len(f)
+}
+func (f Fields) Less(i, j int) bool {
+	return f[i].Key < f[j].Key
+}
+func (f Fields) Swap(i, j int) {
+	f[i], f[j] = f[j], f[i]
+}
+
+// Get returns the value for the given key and true, or nil and false if key
+// does not exist.
+func (f Fields) Get(key string) (interface{}, bool) {
+	for _, field := range f {
+		if field.Key == key {
+			return field.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Merge returns a Fields collection containing the fields of f followed by
+// the fields of other. Values from other replace the values of existing keys
+// in f without changing their position. f and other are not modified, but the
+// result may share memory with them if either is empty.
+func (f Fields) Merge(other Fields) Fields {
+	if len(other) == 0 {
+		return f
+	} else if len(f) == 0 {
+		return other
+	}
+	merged := make(Fields, len(f), len(f)+len(other))
+	copy(merged, f)
+outer:
+	for _, field := range other {
+		for i := range merged {
+			if merged[i].Key == field.Key {
+				merged[i].Value = field.Value
+				continue outer
+			}
+		}
+		merged = append(merged, field)
+	}
+	return merged
+}
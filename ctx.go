@@ -0,0 +1,153 @@
+package log
+
+import (
+	"context"
+	"sync"
+)
+
+// Extractor returns the fields that should be added to entries logged with
+// the given context.Context, e.g. a trace id. See RegisterExtractor.
+type Extractor func(ctx context.Context) Fields
+
+var (
+	extractorsMu sync.RWMutex
+	extractors   []Extractor
+)
+
+// RegisterExtractor adds fn to the extractors called for every entry logged
+// by one of the *Ctx functions or methods. Fields returned by later
+// extractors replace fields with the same key returned by earlier ones.
+func RegisterExtractor(fn Extractor) {
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+	extractors = append(extractors, fn)
+}
+
+// extract adds the fields returned by all registered extractors for ctx to
+// e. Context arguments of e take precedence over the extracted fields. The
+// extractors are called without holding extractorsMu, so they may block or
+// call RegisterExtractor.
+func extract(ctx context.Context, e Entry) Entry {
+	extractorsMu.RLock()
+	fns := extractors
+	extractorsMu.RUnlock()
+
+	var fields Fields
+	for _, fn := range fns {
+		fields = fields.Merge(fn(ctx))
+	}
+	e.Fields = fields.Merge(e.Fields)
+	return e
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx that carries l. Use FromContext to
+// retrieve it.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the *Logger carried by ctx, or DefaultLogger if ctx
+// does not carry one.
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
+	}
+	return DefaultLogger
+}
+
+// DebugCtx logs at the Debug level, adding the fields of all registered
+// extractors for ctx.
+func (l *Logger) DebugCtx(ctx context.Context, args ...interface{}) {
+	if l.Enabled(DEBUG) {
+		l.Log(extract(ctx, NewEntryWithStack(DEBUG, 3, 1, args...)))
+	}
+}
+
+// InfoCtx logs at the Info level, adding the fields of all registered
+// extractors for ctx.
+func (l *Logger) InfoCtx(ctx context.Context, args ...interface{}) {
+	if l.Enabled(INFO) {
+		l.Log(extract(ctx, NewEntryWithStack(INFO, 3, 1, args...)))
+	}
+}
+
+// WarnCtx logs at the Warn level, adding the fields of all registered
+// extractors for ctx.
+func (l *Logger) WarnCtx(ctx context.Context, args ...interface{}) {
+	if l.Enabled(WARN) {
+		l.Log(extract(ctx, NewEntryWithStack(WARN, 3, 1, args...)))
+	}
+}
+
+// ErrorCtx logs at the Error level, adding the fields of all registered
+// extractors for ctx, and returns the formatted error message as an error.
+func (l *Logger) ErrorCtx(ctx context.Context, args ...interface{}) error {
+	if !l.Enabled(ERROR) {
+		return NewError(NewEntry(ERROR, args...))
+	}
+	e := extract(ctx, NewEntryWithStack(ERROR, 3, 1, args...))
+	l.Log(e)
+	return NewError(e)
+}
+
+// PanicCtx is like Panic, but adds the fields of all registered extractors
+// for ctx.
+func (l *Logger) PanicCtx(ctx context.Context, args ...interface{}) {
+	l.panic(extract(ctx, NewEntryWithStack(PANIC, 3, 1, args...)))
+}
+
+// FatalCtx is like Fatal, but adds the fields of all registered extractors
+// for ctx.
+func (l *Logger) FatalCtx(ctx context.Context, args ...interface{}) {
+	l.fatal(extract(ctx, NewEntryWithStack(FATAL, 3, 1, args...)))
+}
+
+// DebugCtx logs at the Debug level using the *Logger returned by
+// FromContext(ctx).
+func DebugCtx(ctx context.Context, args ...interface{}) {
+	if l := FromContext(ctx); l.Enabled(DEBUG) {
+		l.Log(extract(ctx, NewEntryWithStack(DEBUG, 3, 1, args...)))
+	}
+}
+
+// InfoCtx logs at the Info level using the *Logger returned by
+// FromContext(ctx).
+func InfoCtx(ctx context.Context, args ...interface{}) {
+	if l := FromContext(ctx); l.Enabled(INFO) {
+		l.Log(extract(ctx, NewEntryWithStack(INFO, 3, 1, args...)))
+	}
+}
+
+// WarnCtx logs at the Warn level using the *Logger returned by
+// FromContext(ctx).
+func WarnCtx(ctx context.Context, args ...interface{}) {
+	if l := FromContext(ctx); l.Enabled(WARN) {
+		l.Log(extract(ctx, NewEntryWithStack(WARN, 3, 1, args...)))
+	}
+}
+
+// ErrorCtx logs at the Error level using the *Logger returned by
+// FromContext(ctx) and returns the formatted error message as an error.
+func ErrorCtx(ctx context.Context, args ...interface{}) error {
+	l := FromContext(ctx)
+	if !l.Enabled(ERROR) {
+		return NewError(NewEntry(ERROR, args...))
+	}
+	e := extract(ctx, NewEntryWithStack(ERROR, 3, 1, args...))
+	l.Log(e)
+	return NewError(e)
+}
+
+// PanicCtx logs at the Panic level using the *Logger returned by
+// FromContext(ctx), see Logger.Panic.
+func PanicCtx(ctx context.Context, args ...interface{}) {
+	FromContext(ctx).panic(extract(ctx, NewEntryWithStack(PANIC, 3, 1, args...)))
+}
+
+// FatalCtx logs at the Fatal level using the *Logger returned by
+// FromContext(ctx), see Logger.Fatal.
+func FatalCtx(ctx context.Context, args ...interface{}) {
+	FromContext(ctx).fatal(extract(ctx, NewEntryWithStack(FATAL, 3, 1, args...)))
+}
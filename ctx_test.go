@@ -0,0 +1,61 @@
+package log
+
+import (
+	"context"
+	"runtime"
+	"testing"
+)
+
+type traceKey struct{}
+
+// resetExtractors removes all registered extractors.
+func resetExtractors() {
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+	extractors = nil
+}
+
+func TestContext(t *testing.T) {
+	RegisterExtractor(func(ctx context.Context) Fields {
+		if id, ok := ctx.Value(traceKey{}).(string); ok {
+			return Fields{{"trace_id", id}}
+		}
+		return nil
+	})
+	defer resetExtractors()
+
+	l, w := NewTestLogger()
+	ctx := context.WithValue(context.Background(), traceKey{}, "abc")
+	ctx = NewContext(ctx, l.With(Context{"request_id": 1}))
+	if FromContext(context.Background()) != DefaultLogger {
+		t.Errorf("FromContext did not fall back to DefaultLogger")
+	}
+
+	_, file, line, _ := runtime.Caller(0)
+	InfoCtx(ctx, "Test A", Context{"user_id": 2})
+	FromContext(ctx).WarnCtx(ctx, "Test B", Context{"trace_id": "def"})
+	l.DebugCtx(context.Background(), "Test C")
+
+	if !w.MatchLevel("^Test A request_id=1 trace_id=abc user_id=2$", INFO) {
+		t.Errorf("Missing entry: A")
+	}
+	if !w.MatchLevel("^Test B request_id=1 trace_id=def$", WARN) {
+		t.Errorf("Missing entry: B")
+	}
+	if !w.MatchLevel("^Test C$", DEBUG) {
+		t.Errorf("Missing entry: C")
+	}
+	if e := w.Entries[0]; e.File() != file || e.Line() != line+1 {
+		t.Errorf("Bad call site: %s:%d", e.File(), e.Line())
+	}
+
+	// Extractors may register other extractors without deadlocking.
+	RegisterExtractor(func(ctx context.Context) Fields {
+		RegisterExtractor(func(ctx context.Context) Fields { return nil })
+		return nil
+	})
+	l.InfoCtx(ctx, "Test D")
+	if !w.MatchLevel("^Test D trace_id=abc$", INFO) {
+		t.Errorf("Missing entry: D")
+	}
+}
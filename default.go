@@ -15,58 +15,136 @@ var (
 		WARN:  Yellow,
 		ERROR: Red,
 		PANIC: White | BgRed,
+		FATAL: White | BgRed | Bold,
 	}
 	DefaultFormatter        = NewLineFormatter(DefaultLayout, nil)
 	DefaultColorFormatter   = NewLineFormatter(DefaultLayout, DefaultTermStyle)
 	DefaultMessageFormatter = NewLineFormatter("message", nil)
-	DefaultConfig           = Config{
+	DefaultJSONFormatter    = &JSONFormatter{
+		TimeLayout: "2006-01-02T15:04:05.000Z07:00",
+		UTC:        true,
+	}
+	DefaultLogfmtFormatter = &LogfmtFormatter{
+		TimeLayout: "2006-01-02T15:04:05.000Z07:00",
+		UTC:        true,
+	}
+	DefaultConfig = Config{
 		FlushTimeout: 30 * time.Second,
+		ExitCode:     1,
 	}
 	DefaultErrorHandler = func(err error) {
 		e := NewEntry(ERROR, "%s", err)
 		fmt.Fprint(os.Stderr, DefaultFormatter.Format(e))
 	}
 	DefaultFileWriterConfig = FileWriterConfig{
-		Perm:          0600,
-		Formatter:     DefaultFormatter,
-		RotateSignal:  syscall.SIGUSR1,
-		ErrorHandler:  DefaultErrorHandler,
-		Blocking:      false,
-		Capacity:      1024,
-		BufSize:       4096,
-		FlushInterval: time.Second,
+		Perm:             0600,
+		Formatter:        DefaultFormatter,
+		RotateSignal:     syscall.SIGUSR1,
+		ErrorHandler:     DefaultErrorHandler,
+		QueueConfig:      QueueConfig{Capacity: 1024},
+		BufSize:          4096,
+		FlushInterval:    time.Second,
+		RetryInterval:    time.Second,
+		MaxRetryInterval: time.Minute,
+		CompressDelay:    1,
+	}
+	DefaultNetWriterConfig = NetWriterConfig{
+		Formatter:        DefaultJSONFormatter,
+		DialTimeout:      5 * time.Second,
+		WriteTimeout:     5 * time.Second,
+		RetryInterval:    100 * time.Millisecond,
+		MaxRetryInterval: 30 * time.Second,
+		ErrorHandler:     DefaultErrorHandler,
+		QueueConfig:      QueueConfig{Capacity: 1024},
+	}
+	DefaultSyslogWriterConfig = NetWriterConfig{
+		Formatter:        NewSyslogFormatter(RFC5424),
+		DialTimeout:      5 * time.Second,
+		WriteTimeout:     5 * time.Second,
+		RetryInterval:    100 * time.Millisecond,
+		MaxRetryInterval: 30 * time.Second,
+		ErrorHandler:     DefaultErrorHandler,
+		QueueConfig:      QueueConfig{Capacity: 1024},
+	}
+	DefaultHTTPWriterConfig = HTTPWriterConfig{
+		Formatter:        DefaultJSONFormatter,
+		Timeout:          10 * time.Second,
+		BatchSize:        100,
+		BatchBytes:       1 << 20,
+		BatchDelay:       time.Second,
+		MaxRetries:       5,
+		RetryInterval:    time.Second,
+		MaxRetryInterval: time.Minute,
+		ErrorHandler:     DefaultErrorHandler,
+		QueueConfig:      QueueConfig{Capacity: 1024},
+	}
+	DefaultAlertConfig = AlertConfig{
+		Formatter:        DefaultFormatter,
+		DigestDelay:      time.Minute,
+		MaxDigestEntries: 100,
+		ThrottleInterval: time.Hour,
+		ErrorHandler:     DefaultErrorHandler,
+	}
+	DefaultAsyncConfig = AsyncConfig{
+		QueueConfig:  QueueConfig{Capacity: 1024},
+		ErrorHandler: DefaultErrorHandler,
 	}
 	DefaultTermConfig = FileWriterConfig{
 		Writer:       os.Stdout,
 		Formatter:    DefaultColorFormatter,
 		ErrorHandler: DefaultErrorHandler,
-		Blocking:     true,
+		QueueConfig:  QueueConfig{Blocking: true},
 	}
 	DefaultWriter = NewFileWriterConfig(DefaultTermConfig)
 
 	DefaultLogger = NewLogger(DefaultConfig, DefaultWriter)
 )
 
+// With returns a child logger of DefaultLogger that adds the given context to
+// every Entry it logs.
+func With(context Context) *Logger {
+	return DefaultLogger.With(context)
+}
+
 func Debug(args ...interface{}) {
-	DefaultLogger.Log(NewEntryWithStack(DEBUG, 3, 1, args...))
+	if DefaultLogger.Enabled(DEBUG) {
+		DefaultLogger.Log(NewEntryWithStack(DEBUG, 3, 1, args...))
+	}
 }
 
 func Info(args ...interface{}) {
-	DefaultLogger.Log(NewEntryWithStack(INFO, 3, 1, args...))
+	if DefaultLogger.Enabled(INFO) {
+		DefaultLogger.Log(NewEntryWithStack(INFO, 3, 1, args...))
+	}
 }
 
 func Warn(args ...interface{}) {
-	DefaultLogger.Log(NewEntryWithStack(WARN, 3, 1, args...))
+	if DefaultLogger.Enabled(WARN) {
+		DefaultLogger.Log(NewEntryWithStack(WARN, 3, 1, args...))
+	}
 }
 
 func Error(args ...interface{}) error {
+	if !DefaultLogger.Enabled(ERROR) {
+		return NewError(NewEntry(ERROR, args...))
+	}
 	e := NewEntryWithStack(ERROR, 3, 1, args...)
 	DefaultLogger.Log(e)
 	return NewError(e)
 }
 
 func Panic(args ...interface{}) {
-	DefaultLogger.Log(NewEntryWithStack(PANIC, 3, 1, args...))
+	DefaultLogger.panic(NewEntryWithStack(PANIC, 3, 1, args...))
+}
+
+func Fatal(args ...interface{}) {
+	DefaultLogger.fatal(NewEntryWithStack(FATAL, 3, 1, args...))
 }
 
-// @TODO Panic level
+// Audit logs an entry that must not be lost using DefaultLogger, see
+// Logger.Audit. DefaultWriter writes to os.Stdout, which is not durable unless
+// it is redirected to a regular file, so Audit returns an error wrapping
+// ErrNotDurable until DefaultWriter is replaced with a handler writing to one.
+func Audit(lvl Level, args ...interface{}) error {
+	return DefaultLogger.LogDurable(NewEntryWithStack(lvl, 3, 1, args...))
+}
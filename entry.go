@@ -1,35 +1,73 @@
 package log
 
 import (
+	"fmt"
 	"runtime"
 	"time"
 )
 
 // @TODO remove?
 func NewEntry(lvl Level, args ...interface{}) Entry {
+	message, fields := splitArgs(args)
 	return Entry{
-		Time:  time.Now(),
-		Level: lvl,
-		Args:  args,
+		Time:    time.Now(),
+		Level:   lvl,
+		Message: message,
+		Fields:  fields,
+		Args:    args,
 	}
 }
 
 func NewEntryWithStack(lvl Level, skip int, count int, args ...interface{}) Entry {
+	message, fields := splitArgs(args)
 	return Entry{
-		Time:  time.Now(),
-		Level: lvl,
-		Args:  args,
-		Stack: CaptureStack(skip, count),
+		Time:    time.Now(),
+		Level:   lvl,
+		Message: message,
+		Fields:  fields,
+		Args:    args,
+		Stack:   CaptureStack(skip, count),
 	}
 }
 
 type Entry struct {
 	Time  time.Time
 	Level Level
+	// Message is the formatted message of the entry, without its Fields.
+	Message string
+	// Fields holds the merged Context arguments of the entry, as well as the
+	// context bound to the *Logger that created it.
+	Fields Fields
+	// Args holds the unmodified arguments the entry was created from.
 	Args  []interface{}
 	Stack []StackFrame
 }
 
+// splitArgs separates the Context arguments from the given args and returns
+// the formatted message of the remaining args along with the merged fields of
+// all Context arguments. If the first remaining arg is a string, it is used as
+// a format string for the others. args is not modified.
+func splitArgs(args []interface{}) (string, Fields) {
+	var (
+		fields      Fields
+		messageArgs = make([]interface{}, 0, len(args))
+	)
+	for _, arg := range args {
+		if context, ok := arg.(Context); ok {
+			fields = fields.Merge(context.Fields())
+			continue
+		}
+		messageArgs = append(messageArgs, arg)
+	}
+
+	if len(messageArgs) > 0 {
+		if format, ok := messageArgs[0].(string); ok {
+			return fmt.Sprintf(format, messageArgs[1:]...), fields
+		}
+	}
+	return fmt.Sprint(messageArgs...), fields
+}
+
 func (e Entry) File() (file string) {
 	if len(e.Stack) > 0 {
 		file = e.Stack[0].File()
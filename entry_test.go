@@ -2,6 +2,7 @@ package log
 
 import (
 	//"runtime"
+	"reflect"
 	"testing"
 )
 
@@ -27,3 +28,19 @@ func TestNewEntry(t *testing.T) {
 
 	//t.Logf("e: %#v\n", e)
 //}
+
+func TestNewEntry_fields(t *testing.T) {
+	args := []interface{}{"Hello %s", Context{"b": 1, "a": 2}, "World", Context{"b": 3}}
+	e := NewEntry(DEBUG, args...)
+
+	if e.Message != "Hello World" {
+		t.Errorf("Bad message: %q", e.Message)
+	}
+	expected := Fields{{"a", 2}, {"b", 3}}
+	if !reflect.DeepEqual(e.Fields, expected) {
+		t.Errorf("Bad fields: %#v != %#v", e.Fields, expected)
+	}
+	if len(e.Args) != 4 || e.Args[1].(Context)["a"] != 2 || e.Args[2] != "World" {
+		t.Errorf("Args were modified: %#v", e.Args)
+	}
+}
@@ -2,9 +2,12 @@ package log
 
 import (
 	"bufio"
+	"fmt"
 	"io"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sync"
 	"time"
 )
 
@@ -17,43 +20,146 @@ type FileWriterConfig struct {
 	ErrorHandler  ErrorHandler
 	BufSize       int
 	FlushInterval time.Duration
-	Blocking      bool
-	Capacity      int
+
+	// QueueConfig configures the queue of entries waiting to be written.
+	// Capacity and Blocking used to be fields of FileWriterConfig. They are
+	// promoted from QueueConfig, so assignments like config.Capacity = 1024
+	// still work, but composite literals must set them as
+	// QueueConfig: QueueConfig{Capacity: 1024}.
+	QueueConfig
+
+	// MaxSize causes the file to be rotated before a write would make it
+	// grow beyond MaxSize bytes. 0 disables size based rotation.
+	MaxSize int64
+	// RotateInterval causes the file to be rotated when the current time
+	// reaches the next multiple of RotateInterval since the zero time (UTC),
+	// e.g. every full hour for time.Hour or every midnight (UTC) for
+	// 24*time.Hour. 0 disables time based rotation.
+	RotateInterval time.Duration
+	// MaxBackups is the number of rotated files to keep. 0 keeps all of them.
+	MaxBackups int
+	// MaxAge is the duration after which rotated files are removed. 0 keeps
+	// them forever.
+	MaxAge time.Duration
+	// Compress enables gzip compression of rotated files in the background.
+	Compress bool
+	// CompressDelay is the number of most recent rotated files that are left
+	// uncompressed. DefaultFileWriterConfig leaves the most recent one
+	// uncompressed, so it can still be read by tools tailing it.
+	CompressDelay int
+	// WatchInterval enables checking if the file at Path was deleted or
+	// replaced every WatchInterval, in which case it is reopened. 0 disables
+	// watching.
+	WatchInterval time.Duration
+	// MkdirAll creates missing parent directories of Path.
+	MkdirAll bool
+	// Fallback receives the entries written while Path can not be opened,
+	// e.g. os.Stderr. If it is nil, up to Capacity entries are kept in memory
+	// instead and written once Path can be opened again.
+	Fallback io.Writer
+	// RetryInterval is the delay before retrying to open Path after it
+	// failed. It is doubled after every failed attempt, up to
+	// MaxRetryInterval. If it is 0, opening is retried on every write.
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+	// Sync determines when the file at Path, or the Writer if it is a regular
+	// *os.File, is synced to disk, using the SyncEntries, SyncInterval or
+	// SyncLevel setting of the policy.
+	Sync         SyncPolicy
+	SyncEntries  int
+	SyncInterval time.Duration
+	SyncLevel    Level
+	// Synchronous causes Log to return only after the entry was written and
+	// synced to disk, bypassing Capacity, Overflow and Spill.
+	Synchronous bool
 }
 
 type FileWriter struct {
-	config FileWriterConfig
-	file   *os.File
-	writer io.Writer
-	opCh   chan interface{}
+	config   FileWriterConfig
+	file     *os.File
+	writer   io.Writer
+	queue    *queue
+	rotateCh chan os.Signal
+	// size is the number of bytes written to file, nextRotation the time at
+	// which it should be rotated because of config.RotateInterval.
+	size         int64
+	nextRotation time.Time
+	now          func() time.Time
+	// compressCh triggers compressLoop, which closes compressDone when it
+	// returns.
+	compressCh   chan struct{}
+	compressDone chan struct{}
+	// While Path can not be opened, pending holds the messages to write once
+	// it can, and dropped counts the messages that did not fit. retryDelay
+	// is the current backoff delay and nextRetry the time of the next open
+	// attempt.
+	pending    []string
+	dropped    int
+	retryDelay time.Duration
+	nextRetry  time.Time
+	// unsynced is the number of entries written since the file was last
+	// synced. writerFile is config.Writer if it is a regular file, which
+	// makes it possible to sync it in LogDurable.
+	unsynced   int
+	writerFile *os.File
+	// openErr is the error of the last failed attempt to open Path, or nil if
+	// Path is open. It is guarded by errMu, see Err.
+	errMu   sync.Mutex
+	openErr error
 }
 
 type flusher interface {
 	Flush() error
 }
 
-type flushReq chan struct{}
-
 type rotateReq struct{}
 
-func NewFileWriterConfig(config FileWriterConfig) *FileWriter {
-	w := &FileWriter{
-		config: config,
-		opCh:   make(chan interface{}, config.Capacity),
-	}
+type watchReq struct{}
 
+func NewFileWriterConfig(config FileWriterConfig) *FileWriter {
+	w := &FileWriter{config: config, now: time.Now}
 	if config.Writer != nil {
 		w.setWriter(config.Writer, config.BufSize)
-	} else {
-		if config.RotateSignal != nil {
-			rotateCh := make(chan os.Signal, 1)
-			signal.Notify(rotateCh, config.RotateSignal)
-			go w.rotateLoop(rotateCh)
+		if file, ok := config.Writer.(*os.File); ok {
+			if info, err := file.Stat(); err == nil && info.Mode().IsRegular() {
+				w.writerFile = file
+			}
 		}
+	} else {
 		w.open()
 	}
+	queue, err := newQueueFromConfig(config.QueueConfig, w, w.error)
+	if err != nil {
+		// Entries are only queued in memory if the spill can not be opened.
+		w.error(err)
+		queueConfig := config.QueueConfig
+		queueConfig.Spill = SpillConfig{}
+		queue, _ = newQueueFromConfig(queueConfig, w, w.error)
+	}
+	w.queue = queue
 
-	go w.opLoop()
+	if config.Writer == nil {
+		if config.RotateSignal != nil {
+			w.rotateCh = make(chan os.Signal, 1)
+			signal.Notify(w.rotateCh, config.RotateSignal)
+			go w.rotateLoop()
+		}
+		if config.Compress {
+			w.compressCh = make(chan struct{}, 1)
+			w.compressDone = make(chan struct{})
+			w.compressCh <- struct{}{}
+			go w.compressLoop()
+		}
+		if config.WatchInterval > 0 {
+			go w.watchLoop()
+		}
+		if config.Sync == SyncInterval && config.SyncInterval > 0 {
+			go w.syncLoop()
+		}
+	}
+	if config.BufSize > 0 && config.FlushInterval != 0 {
+		go w.flushLoop()
+	}
 	return w
 }
 
@@ -64,95 +170,322 @@ func NewFileWriter(path string) *FileWriter {
 }
 
 func (w *FileWriter) Log(entry Entry) {
+	select {
+	case <-w.queue.closing:
+		w.error(ErrClosed)
+		return
+	default:
+	}
 	message := w.config.Formatter.Format(entry)
-
-	if w.config.Blocking {
-		w.opCh <- message
+	if w.config.Synchronous {
+		w.logSync(message)
 		return
 	}
+	w.queue.push(message, entry)
+	if w.config.Sync == SyncLevel && entry.Level >= w.config.SyncLevel {
+		// The request is merged into one that is still queued after the last
+		// entry, so entries that were dropped or spilled do not add requests
+		// beyond Capacity.
+		w.queue.send(syncReq{})
+	}
+}
 
-	select {
-	case w.opCh <- message:
-	default:
-		w.error(&ErrEntryDropped{entry})
-		return
+// LogDurable writes entry like Log does if config.Synchronous is set, and
+// returns an error if it could not be written and synced to the file, e.g.
+// because it was written to config.Fallback instead. If config.Writer is not a
+// regular file, e.g. os.Stdout, the entry is written to it and ErrNotDurable is
+// returned.
+func (w *FileWriter) LogDurable(entry Entry) error {
+	err := w.logSync(w.config.Formatter.Format(entry))
+	if err == nil && w.config.Writer != nil && w.writerFile == nil {
+		return ErrNotDurable
 	}
+	return err
 }
 
 func (w *FileWriter) Flush() {
-	req := make(flushReq)
-	w.opCh <- req
-	<-req
+	w.queue.flush()
+}
+
+// Close flushes all buffered entries, stops all background goroutines and
+// closes the file opened for config.Path. config.Writer is not closed. If
+// config.Compress is set, Close waits for pending compressions. Calls to Log
+// after Close report ErrClosed to the ErrorHandler.
+func (w *FileWriter) Close() error {
+	if w.rotateCh != nil {
+		signal.Stop(w.rotateCh)
+	}
+	err := w.queue.close()
+	if w.compressDone != nil {
+		<-w.compressDone
+	}
+	return err
+}
+
+// Name returns the path of the file written to, or the type of
+// config.Writer.
+func (w *FileWriter) Name() string {
+	if w.config.Writer != nil {
+		return fmt.Sprintf("FileWriter(%T)", w.config.Writer)
+	}
+	return fmt.Sprintf("FileWriter(%s)", w.config.Path)
+}
+
+// Err returns the error that prevents the file at config.Path from being
+// opened, or nil if the FileWriter is healthy. While it is unhealthy, entries
+// are written to config.Fallback or kept in memory.
+func (w *FileWriter) Err() error {
+	w.errMu.Lock()
+	defer w.errMu.Unlock()
+	return w.openErr
 }
 
 func (w *FileWriter) open() {
+	if w.config.MkdirAll {
+		if err := os.MkdirAll(filepath.Dir(w.config.Path), dirPerm(w.config.Perm)); err != nil {
+			w.openFailed(err)
+			return
+		}
+	}
 	file, err := os.OpenFile(w.config.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, w.config.Perm)
 	if err != nil {
-		w.error(err)
-		w.file = nil
-		w.writer = nil
+		w.openFailed(err)
 		return
 	}
 	w.file = file
 	w.setWriter(file, w.config.BufSize)
+
+	w.size = 0
+	created := w.now()
+	if info, err := file.Stat(); err != nil {
+		w.error(err)
+	} else if info.Size() > 0 {
+		w.size = info.Size()
+		created = info.ModTime()
+	}
+	if w.config.RotateInterval > 0 {
+		w.nextRotation = created.Truncate(w.config.RotateInterval).Add(w.config.RotateInterval)
+	}
+
+	w.setOpenErr(nil)
+	w.retryDelay = 0
+	w.writePending()
 }
 
-func (w *FileWriter) opLoop() {
-	for op := range w.opCh {
-		switch t := op.(type) {
-		case string:
-			w.log(t)
-		case flushReq:
-			w.flush()
-			t <- struct{}{}
-		case rotateReq:
+// openFailed reports err and schedules the next attempt to open the file.
+func (w *FileWriter) openFailed(err error) {
+	w.error(err)
+	w.setOpenErr(err)
+	w.file = nil
+	w.writer = nil
+
+	w.retryDelay = backoff(w.retryDelay, w.config.RetryInterval, w.config.MaxRetryInterval)
+	w.nextRetry = w.now().Add(w.retryDelay)
+}
+
+func (w *FileWriter) setOpenErr(err error) {
+	w.errMu.Lock()
+	defer w.errMu.Unlock()
+	w.openErr = err
+}
+
+// reopen tries to open the file if it is not open and the retry delay has
+// passed. It returns true if the file is open.
+func (w *FileWriter) reopen() bool {
+	if w.writer == nil && !w.now().Before(w.nextRetry) {
+		w.open()
+	}
+	return w.writer != nil
+}
+
+// logDegraded handles a message that can not be written to the file.
+func (w *FileWriter) logDegraded(message string) {
+	if w.config.Fallback != nil {
+		if _, err := io.WriteString(w.config.Fallback, message); err != nil {
+			w.error(err)
+		}
+		return
+	}
+	if len(w.pending) < w.config.Capacity {
+		w.pending = append(w.pending, message)
+	} else {
+		w.dropped++
+	}
+}
+
+// writePending writes the messages kept in memory while the file could not
+// be opened.
+func (w *FileWriter) writePending() {
+	pending, dropped := w.pending, w.dropped
+	w.pending, w.dropped = nil, 0
+	if dropped > 0 {
+		w.error(fmt.Errorf("Dropped %d log entries while %s could not be opened.", dropped, w.config.Path))
+	}
+	for _, message := range pending {
+		w.log(message)
+	}
+}
+
+// dirPerm returns the permissions for directories created for a file with
+// the given permissions, adding execute permissions where read permissions
+// are set.
+func dirPerm(perm os.FileMode) os.FileMode {
+	return perm | (perm&0444)>>2
+}
+
+func (w *FileWriter) handleOp(op interface{}) {
+	switch t := op.(type) {
+	case string:
+		w.log(t)
+		if w.config.Sync == SyncEntries && w.unsynced >= w.config.SyncEntries {
+			w.sync()
+		}
+	case syncReq:
+		w.handleSync(t)
+	case rotateReq:
+		w.rotate()
+	case watchReq:
+		if w.moved() {
 			w.rotate()
 		}
 	}
 }
 
+func (w *FileWriter) handleFlush() {
+	w.reopen()
+	if w.config.Sync == SyncFlush {
+		w.sync()
+	} else {
+		w.flush()
+	}
+}
+
+func (w *FileWriter) handleClose() error {
+	if w.writer == nil && w.config.Writer == nil {
+		w.open()
+		if w.writer == nil && len(w.pending)+w.dropped > 0 {
+			w.error(fmt.Errorf("Dropped %d log entries because %s could not be opened.", len(w.pending)+w.dropped, w.config.Path))
+		}
+	}
+	w.closeFile()
+	if w.file != nil {
+		return w.file.Close()
+	}
+	return nil
+}
+
 func (w *FileWriter) setWriter(writer io.Writer, bufSize int) {
 	if bufSize > 0 {
 		w.writer = bufio.NewWriterSize(writer, bufSize)
-		if w.config.FlushInterval != 0 {
-			go w.flushLoop()
-		}
 		return
 	}
 	w.writer = writer
 }
 
 func (w *FileWriter) flushLoop() {
+	ticker := time.NewTicker(w.config.FlushInterval)
+	defer ticker.Stop()
 	for {
-		w.Flush()
-		time.Sleep(w.config.FlushInterval)
+		select {
+		case <-ticker.C:
+			w.Flush()
+		case <-w.queue.closing:
+			return
+		}
 	}
 }
 
-func (w *FileWriter) log(message string) {
-	if _, err := io.WriteString(w.writer, message); err != nil {
+// log writes message to the file. It returns an error if message could not be
+// written to it, which has already been reported to the ErrorHandler.
+func (w *FileWriter) log(message string) error {
+	if !w.reopen() {
+		w.logDegraded(message)
+		return w.Err()
+	}
+	if w.needsRotation(len(message)) {
+		w.rotateBackup()
+	}
+	n, err := io.WriteString(w.writer, message)
+	w.size += int64(n)
+	w.unsynced++
+	if err != nil {
 		w.error(err)
 	}
+	return err
 }
 
-func (w *FileWriter) flush() {
+func (w *FileWriter) flush() error {
 	if flusher, ok := w.writer.(flusher); ok {
 		if err := flusher.Flush(); err != nil {
 			w.error(err)
+			return err
 		}
 	}
+	return nil
 }
 
-func (w *FileWriter) rotateLoop(rotateCh <-chan os.Signal) {
-	for _ = range rotateCh {
-		w.opCh <- rotateReq{}
+// closeFile prepares the file for being closed by flushing it, and syncing it
+// unless config.Sync is SyncNever.
+func (w *FileWriter) closeFile() {
+	if w.config.Sync == SyncNever && !w.config.Synchronous {
+		w.flush()
+	} else {
+		w.sync()
 	}
 }
 
-func (w *FileWriter) rotate() {
-	w.flush()
-	if err := w.file.Close(); err != nil {
+func (w *FileWriter) rotateLoop() {
+	for {
+		select {
+		case <-w.rotateCh:
+			if !w.queue.send(rotateReq{}) {
+				return
+			}
+		case <-w.queue.closing:
+			return
+		}
+	}
+}
+
+func (w *FileWriter) watchLoop() {
+	ticker := time.NewTicker(w.config.WatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !w.queue.send(watchReq{}) {
+				return
+			}
+		case <-w.queue.closing:
+			return
+		}
+	}
+}
+
+// moved returns true if the file at config.Path is no longer the file being
+// written to, e.g. because it was deleted or renamed.
+func (w *FileWriter) moved() bool {
+	if w.file == nil {
+		return false
+	}
+	info, err := w.file.Stat()
+	if err != nil {
 		w.error(err)
+		return false
+	}
+	pathInfo, err := os.Stat(w.config.Path)
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(info, pathInfo)
+}
+
+func (w *FileWriter) rotate() {
+	if w.file != nil {
+		w.closeFile()
+		if err := w.file.Close(); err != nil {
+			w.error(err)
+		}
 	}
 	w.open()
 }
@@ -0,0 +1,128 @@
+package log
+
+import (
+	"os"
+)
+
+// NewFileWriterE is like NewFileWriterConfig, but returns an error instead of
+// a *FileWriter if config is invalid, see FileWriterConfig.Validate. Before
+// validating, the zero settings of config that DefaultFileWriterConfig sets are
+// replaced with its values. Perm and RotateSignal are only replaced if Path is
+// set.
+func NewFileWriterE(config FileWriterConfig) (*FileWriter, error) {
+	config = config.withDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return NewFileWriterConfig(config), nil
+}
+
+// withDefaults returns c with its zero settings replaced by the ones of
+// DefaultFileWriterConfig, see NewFileWriterE.
+func (c FileWriterConfig) withDefaults() FileWriterConfig {
+	d := DefaultFileWriterConfig
+	if c.Path != "" {
+		if c.Perm == 0 {
+			c.Perm = d.Perm
+		}
+		if c.RotateSignal == nil {
+			c.RotateSignal = d.RotateSignal
+		}
+	}
+	if c.Formatter == nil {
+		c.Formatter = d.Formatter
+	}
+	if c.ErrorHandler == nil {
+		c.ErrorHandler = d.ErrorHandler
+	}
+	if c.Capacity == 0 {
+		c.Capacity = d.Capacity
+	}
+	if c.BufSize == 0 {
+		c.BufSize = d.BufSize
+	}
+	if c.FlushInterval == 0 {
+		c.FlushInterval = d.FlushInterval
+	}
+	if c.RetryInterval == 0 {
+		c.RetryInterval = d.RetryInterval
+	}
+	if c.MaxRetryInterval == 0 {
+		c.MaxRetryInterval = d.MaxRetryInterval
+	}
+	if c.CompressDelay == 0 {
+		c.CompressDelay = d.CompressDelay
+	}
+	return c
+}
+
+// Validate returns an error describing the first invalid setting of c, or nil
+// if c is valid. RotateSignal is ignored if Writer is set, so configs copied
+// from DefaultFileWriterConfig can be used with a Writer.
+func (c FileWriterConfig) Validate() error {
+	const config = "FileWriterConfig"
+	if c.Path == "" && c.Writer == nil {
+		return invalidConfig(config, "Path or Writer must be set")
+	} else if c.Path != "" && c.Writer != nil {
+		return invalidConfig(config, "Path and Writer must not both be set")
+	} else if c.Formatter == nil {
+		return invalidConfig(config, "Formatter must be set")
+	}
+
+	err := validateNonNegative(config,
+		configSetting{"BufSize", int64(c.BufSize)},
+		configSetting{"FlushInterval", int64(c.FlushInterval)},
+		configSetting{"MaxSize", c.MaxSize},
+		configSetting{"RotateInterval", int64(c.RotateInterval)},
+		configSetting{"MaxBackups", int64(c.MaxBackups)},
+		configSetting{"MaxAge", int64(c.MaxAge)},
+		configSetting{"CompressDelay", int64(c.CompressDelay)},
+		configSetting{"WatchInterval", int64(c.WatchInterval)},
+		configSetting{"RetryInterval", int64(c.RetryInterval)},
+		configSetting{"MaxRetryInterval", int64(c.MaxRetryInterval)},
+		configSetting{"SyncEntries", int64(c.SyncEntries)},
+		configSetting{"SyncInterval", int64(c.SyncInterval)},
+	)
+	if err == nil {
+		err = c.QueueConfig.validate(config)
+	}
+	if err == nil {
+		err = validateRetry(config, c.RetryInterval, c.MaxRetryInterval)
+	}
+	if err != nil {
+		return err
+	} else if c.FlushInterval > 0 && c.BufSize == 0 {
+		return invalidConfig(config, "FlushInterval requires BufSize")
+	} else if c.Sync < SyncNever || c.Sync > SyncLevel {
+		return invalidConfig(config, "Sync must be a valid SyncPolicy")
+	} else if c.Sync == SyncEntries && c.SyncEntries == 0 {
+		return invalidConfig(config, "Sync policy SyncEntries requires SyncEntries")
+	} else if c.Sync == SyncInterval && c.SyncInterval == 0 {
+		return invalidConfig(config, "Sync policy SyncInterval requires SyncInterval")
+	}
+
+	if c.Path != "" {
+		return nil
+	} else if _, ok := c.Writer.(*os.File); c.Sync != SyncNever && !ok {
+		// FileWriter syncs Writers that are regular files, see LogDurable.
+		return invalidConfig(config, "Sync requires Path or an *os.File Writer")
+	}
+	for _, setting := range []struct {
+		name string
+		set  bool
+	}{
+		{"MaxSize", c.MaxSize > 0},
+		{"RotateInterval", c.RotateInterval > 0},
+		{"MaxBackups", c.MaxBackups > 0},
+		{"MaxAge", c.MaxAge > 0},
+		{"Compress", c.Compress},
+		{"WatchInterval", c.WatchInterval > 0},
+		{"MkdirAll", c.MkdirAll},
+		{"Fallback", c.Fallback != nil},
+	} {
+		if setting.set {
+			return invalidConfig(config, "%s requires Path", setting.name)
+		}
+	}
+	return nil
+}
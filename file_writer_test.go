@@ -1,5 +1,19 @@
 package log
 
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
 //import (
 //"io/ioutil"
 //"os"
@@ -24,3 +38,478 @@ package log
 //t.Errorf()
 //}
 //}
+
+// errorRecorder collects the errors passed to its Handle method.
+type errorRecorder struct {
+	mu     sync.Mutex
+	errors []error
+}
+
+func (r *errorRecorder) Handle(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, err)
+}
+
+func (r *errorRecorder) Errors() []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]error(nil), r.errors...)
+}
+
+func TestFileWriter_Close(t *testing.T) {
+	// os/signal starts a goroutine on first use that never terminates.
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, DefaultFileWriterConfig.RotateSignal)
+	signal.Stop(signalCh)
+
+	var (
+		path       = filepath.Join(t.TempDir(), "test.log")
+		errs       = &errorRecorder{}
+		goroutines = runtime.NumGoroutine()
+		config     = DefaultFileWriterConfig
+	)
+	config.Path = path
+	config.Formatter = DefaultMessageFormatter
+	config.ErrorHandler = errs.Handle
+	config.FlushInterval = time.Millisecond
+
+	w := NewFileWriterConfig(config)
+	l := NewLogger(DefaultConfig, w)
+	l.Info("A")
+	l.Info("B")
+	if err := l.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	l.Info("C")
+	w.Flush()
+	if err := w.Close(); err != ErrClosed {
+		t.Errorf("Bad error for second Close: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "A\nB\n" {
+		t.Errorf("Bad data: %q", data)
+	}
+	if errors := errs.Errors(); len(errors) != 1 || errors[0] != ErrClosed {
+		t.Errorf("Bad errors: %v", errors)
+	}
+
+	for i := 0; runtime.NumGoroutine() > goroutines; i++ {
+		if i > 100 {
+			t.Fatalf("Leaked goroutines: %d > %d", runtime.NumGoroutine(), goroutines)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFileWriter_rotation(t *testing.T) {
+	var (
+		path   = filepath.Join(t.TempDir(), "test.log")
+		errs   = &errorRecorder{}
+		config = DefaultFileWriterConfig
+	)
+	config.Path = path
+	config.Formatter = DefaultMessageFormatter
+	config.ErrorHandler = errs.Handle
+	config.MaxSize = 10
+	config.MaxBackups = 2
+	config.RotateInterval = time.Hour
+
+	w := NewFileWriterConfig(config)
+	l := NewLogger(DefaultConfig, w)
+	for i := 1; i <= 4; i++ {
+		l.Info("line%d", i)
+	}
+	l.Flush()
+	now := time.Now().Add(time.Hour)
+	w.now = func() time.Time { return now }
+	l.Info("line5")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := w.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"line4\n", "line3\n", "line5\n"}
+	if len(backups) != 2 {
+		t.Fatalf("Bad #backups: %d", len(backups))
+	}
+	for i, path := range []string{backups[0].path, backups[1].path, path} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		} else if string(data) != expected[i] {
+			t.Errorf("Bad data in %s: %q != %q", path, data, expected[i])
+		}
+	}
+	if errors := errs.Errors(); len(errors) > 0 {
+		t.Errorf("Unexpected errors: %v", errors)
+	}
+}
+
+func TestFileWriter_compress(t *testing.T) {
+	var (
+		path   = filepath.Join(t.TempDir(), "test.log")
+		errs   = &errorRecorder{}
+		config = DefaultFileWriterConfig
+	)
+	config.Path = path
+	config.Formatter = DefaultMessageFormatter
+	config.ErrorHandler = errs.Handle
+	config.MaxSize = 10
+	config.Compress = true
+
+	w := NewFileWriterConfig(config)
+	l := NewLogger(DefaultConfig, w)
+	for i := 1; i <= 3; i++ {
+		l.Info("line%d", i)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := w.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 || backups[0].compressed || !backups[1].compressed {
+		t.Fatalf("Bad backups: %v", backups)
+	}
+	file, err := os.Open(backups[1].path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := io.ReadAll(gz); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "line1\n" {
+		t.Errorf("Bad data: %q", data)
+	}
+	if matches, _ := filepath.Glob(path + "*.tmp"); len(matches) > 0 {
+		t.Errorf("Leftover temporary files: %v", matches)
+	}
+	if errors := errs.Errors(); len(errors) > 0 {
+		t.Errorf("Unexpected errors: %v", errors)
+	}
+}
+
+func TestFileWriter_watch(t *testing.T) {
+	var (
+		path   = filepath.Join(t.TempDir(), "test.log")
+		errs   = &errorRecorder{}
+		config = DefaultFileWriterConfig
+	)
+	config.Path = path
+	config.Formatter = DefaultMessageFormatter
+	config.ErrorHandler = errs.Handle
+	config.WatchInterval = time.Millisecond
+
+	w := NewFileWriterConfig(config)
+	l := NewLogger(DefaultConfig, w)
+	l.Info("A")
+	l.Flush()
+	if err := os.Rename(path, path+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		if _, err := os.Stat(path); err == nil {
+			break
+		} else if i > 1000 {
+			t.Fatal("File was not reopened")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	l.Info("B")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for p, expected := range map[string]string{path + ".moved": "A\n", path: "B\n"} {
+		if data, err := os.ReadFile(p); err != nil {
+			t.Fatal(err)
+		} else if string(data) != expected {
+			t.Errorf("Bad data in %s: %q != %q", p, data, expected)
+		}
+	}
+	if errors := errs.Errors(); len(errors) > 0 {
+		t.Errorf("Unexpected errors: %v", errors)
+	}
+}
+
+func TestFileWriter_openFailure(t *testing.T) {
+	var (
+		dir      = filepath.Join(t.TempDir(), "sub")
+		path     = filepath.Join(dir, "test.log")
+		errs     = &errorRecorder{}
+		fallback = &bytes.Buffer{}
+		config   = DefaultFileWriterConfig
+	)
+	config.Path = path
+	config.Formatter = DefaultMessageFormatter
+	config.ErrorHandler = errs.Handle
+	config.RetryInterval = 0
+	config.Capacity = 1
+	config.Blocking = true
+
+	w := NewFileWriterConfig(config)
+	l := NewLogger(DefaultConfig, w)
+	l.Info("A")
+	l.Info("B")
+	l.Flush()
+	if w.Err() == nil {
+		t.Errorf("Expected error")
+	}
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	l.Info("C")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if w.Err() != nil {
+		t.Errorf("Unexpected error: %s", w.Err())
+	}
+	if data, err := os.ReadFile(path); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "A\nC\n" {
+		t.Errorf("Bad data: %q", data)
+	}
+	expected := "Dropped 1 log entries while " + path + " could not be opened."
+	if errors := errs.Errors(); errors[len(errors)-1].Error() != expected {
+		t.Errorf("Bad errors: %v", errors)
+	}
+
+	config.Path = filepath.Join(dir, "missing", "test.log")
+	config.Fallback = fallback
+	w = NewFileWriterConfig(config)
+	w.Log(NewEntry(INFO, "D"))
+	w.Flush()
+	if fallback.String() != "D\n" {
+		t.Errorf("Bad fallback data: %q", fallback.String())
+	}
+	w.Close()
+
+	config.MkdirAll = true
+	w = NewFileWriterConfig(config)
+	w.Log(NewEntry(INFO, "E"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(config.Path); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "E\n" {
+		t.Errorf("Bad data: %q", data)
+	}
+}
+
+func TestFileWriterConfig_Validate(t *testing.T) {
+	tests := []struct {
+		modify func(c *FileWriterConfig)
+		err    string
+	}{
+		{func(c *FileWriterConfig) {}, ""},
+		{func(c *FileWriterConfig) { c.Path = "" }, "Path or Writer must be set"},
+		{func(c *FileWriterConfig) { c.Writer = io.Discard }, "Path and Writer must not both be set"},
+		{func(c *FileWriterConfig) { c.Formatter = nil }, "Formatter must be set"},
+		{func(c *FileWriterConfig) { c.Capacity = -1 }, "Capacity must not be negative"},
+		{func(c *FileWriterConfig) { c.BufSize = 0 }, "FlushInterval requires BufSize"},
+		{func(c *FileWriterConfig) { c.MaxRetryInterval = time.Millisecond }, "MaxRetryInterval must not be less than RetryInterval"},
+		{func(c *FileWriterConfig) { c.Sync = SyncEntries }, "Sync policy SyncEntries requires SyncEntries"},
+		{func(c *FileWriterConfig) { c.Path, c.Writer = "", io.Discard }, ""},
+		{func(c *FileWriterConfig) { c.Path, c.Writer, c.MaxSize = "", io.Discard, 1 }, "MaxSize requires Path"},
+		{func(c *FileWriterConfig) { c.Path, c.Writer, c.Sync = "", os.Stdout, SyncFlush }, ""},
+		{func(c *FileWriterConfig) { c.Path, c.Writer, c.Sync = "", io.Discard, SyncFlush }, "Sync requires Path or an *os.File Writer"},
+	}
+
+	for _, test := range tests {
+		config := DefaultFileWriterConfig
+		config.Path = "test.log"
+		test.modify(&config)
+
+		err := config.Validate()
+		if test.err == "" && err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		} else if expected := "Invalid FileWriterConfig: " + test.err + "."; test.err != "" && (err == nil || err.Error() != expected) {
+			t.Errorf("Bad error: %v != %s", err, expected)
+		}
+	}
+
+	if _, err := NewFileWriterE(FileWriterConfig{}); err == nil {
+		t.Errorf("Expected error")
+	}
+	w, err := NewFileWriterE(FileWriterConfig{Writer: io.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.config.Formatter != DefaultFileWriterConfig.Formatter {
+		t.Errorf("Formatter default was not applied")
+	}
+	if w.config.ErrorHandler == nil || w.config.Capacity != DefaultFileWriterConfig.Capacity || w.config.RotateSignal != nil {
+		t.Errorf("Bad defaults: %+v", w.config)
+	}
+	w.Close()
+}
+
+// gateWriter is an io.Writer that writes to buf once release is closed. Write
+// sends to entered without blocking before waiting for release.
+type gateWriter struct {
+	buf     bytes.Buffer
+	release chan struct{}
+	entered chan struct{}
+}
+
+func (w *gateWriter) Write(p []byte) (int, error) {
+	select {
+	case w.entered <- struct{}{}:
+	default:
+	}
+	<-w.release
+	return w.buf.Write(p)
+}
+
+func TestFileWriter_spill(t *testing.T) {
+	var (
+		dir    = t.TempDir()
+		errs   = &errorRecorder{}
+		gate   = &gateWriter{release: make(chan struct{}), entered: make(chan struct{}, 1)}
+		config = DefaultFileWriterConfig
+	)
+	config.Writer = gate
+	config.BufSize = 0
+	config.FlushInterval = 0
+	config.Formatter = DefaultMessageFormatter
+	config.ErrorHandler = errs.Handle
+	config.Capacity = 1
+	config.Spill = SpillConfig{Dir: dir, SegmentSize: 16}
+
+	w := NewFileWriterConfig(config)
+	w.Log(NewEntry(INFO, "0"))
+	<-gate.entered
+	for i := 1; i < 10; i++ {
+		w.Log(NewEntry(INFO, "%d", i))
+	}
+	if segments, _ := filepath.Glob(filepath.Join(dir, "*.seg")); len(segments) != 8 {
+		t.Errorf("Bad #segments: %d", len(segments))
+	}
+	close(gate.release)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if data := gate.buf.String(); data != "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n" {
+		t.Errorf("Bad data: %q", data)
+	}
+	if errors := errs.Errors(); len(errors) != 0 {
+		t.Errorf("Unexpected errors: %v", errors)
+	}
+	if segments, _ := filepath.Glob(filepath.Join(dir, "*.seg")); len(segments) != 0 {
+		t.Errorf("Segments left: %v", segments)
+	}
+}
+
+func TestFileWriter_sync(t *testing.T) {
+	tests := []struct {
+		modify   func(c *FileWriterConfig)
+		levels   []Level
+		unsynced int
+	}{
+		{func(c *FileWriterConfig) {}, []Level{INFO, INFO}, 2},
+		{func(c *FileWriterConfig) { c.Sync = SyncFlush }, []Level{INFO, INFO}, 0},
+		{func(c *FileWriterConfig) { c.Sync, c.SyncEntries = SyncEntries, 2 }, []Level{INFO, INFO, INFO}, 1},
+		{func(c *FileWriterConfig) { c.Sync, c.SyncLevel = SyncLevel, ERROR }, []Level{INFO, ERROR, INFO}, 1},
+	}
+
+	for i, test := range tests {
+		config := DefaultFileWriterConfig
+		config.Path = filepath.Join(t.TempDir(), "test.log")
+		config.Formatter = DefaultMessageFormatter
+		config.FlushInterval = 0
+		config.RotateSignal = nil
+		test.modify(&config)
+
+		w := NewFileWriterConfig(config)
+		for _, lvl := range test.levels {
+			w.Log(NewEntry(lvl, "A"))
+		}
+		w.Flush()
+		if w.unsynced != test.unsynced {
+			t.Errorf("test %d: Bad #unsynced: %d != %d", i, w.unsynced, test.unsynced)
+		}
+		w.Close()
+	}
+
+	// While the writer is stuck, entries at SyncLevel must not queue more
+	// sync requests than entries fit into the queue.
+	var (
+		armed   = make(chan struct{})
+		release = make(chan struct{})
+		stuck   = make(chan struct{}, 1)
+		config  = DefaultFileWriterConfig
+	)
+	config.Path = filepath.Join(t.TempDir(), "missing", "test.log")
+	config.Formatter = DefaultMessageFormatter
+	config.FlushInterval = 0
+	config.RotateSignal = nil
+	config.RetryInterval = 0
+	config.Capacity = 2
+	config.Sync, config.SyncLevel = SyncLevel, ERROR
+	config.ErrorHandler = func(err error) {
+		select {
+		case <-armed:
+		default:
+			return
+		}
+		if _, ok := err.(*os.PathError); ok {
+			select {
+			case stuck <- struct{}{}:
+			default:
+			}
+			<-release
+		}
+	}
+	w := NewFileWriterConfig(config)
+	close(armed)
+	w.Log(NewEntry(INFO, "A"))
+	<-stuck
+	for i := 0; i < 10000; i++ {
+		w.Log(NewEntry(ERROR, "B"))
+	}
+	w.queue.mu.Lock()
+	items := len(w.queue.items)
+	w.queue.mu.Unlock()
+	if items > 2*config.Capacity+1 {
+		t.Errorf("Bad #items: %d", items)
+	}
+	close(release)
+	w.Close()
+
+	errs := &errorRecorder{}
+	config.Path = filepath.Join(t.TempDir(), "test.log")
+	config.ErrorHandler = errs.Handle
+	config.Capacity = DefaultFileWriterConfig.Capacity
+	config.Sync = SyncNever
+	config.Synchronous = true
+
+	w = NewFileWriterConfig(config)
+	w.Log(NewEntry(INFO, "A"))
+	if data, err := os.ReadFile(config.Path); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "A\n" || w.unsynced != 0 {
+		t.Errorf("Entry was not synced: %q", data)
+	}
+	w.Close()
+	w.Log(NewEntry(INFO, "B"))
+	if errors := errs.Errors(); len(errors) != 1 || errors[0] != ErrClosed {
+		t.Errorf("Bad errors: %v", errors)
+	}
+}
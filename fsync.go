@@ -0,0 +1,91 @@
+package log
+
+import (
+	"time"
+)
+
+// SyncPolicy determines when a FileWriter calls Sync on its file to commit the
+// written entries to stable storage.
+type SyncPolicy int
+
+const (
+	// SyncNever leaves it to the operating system to write the file to disk.
+	SyncNever SyncPolicy = iota
+	// SyncFlush syncs the file whenever it is flushed.
+	SyncFlush
+	// SyncEntries syncs the file after every FileWriterConfig.SyncEntries
+	// entries.
+	SyncEntries
+	// SyncInterval syncs the file every FileWriterConfig.SyncInterval if
+	// entries were written since the last sync.
+	SyncInterval
+	// SyncLevel syncs the file after every entry at or above
+	// FileWriterConfig.SyncLevel.
+	SyncLevel
+)
+
+// syncReq causes the file to be synced after writing message, unless it is
+// empty. The result is sent to done, unless it is nil.
+type syncReq struct {
+	message string
+	done    chan error
+}
+
+// logSync writes message and syncs the file, returning once it is done.
+func (w *FileWriter) logSync(message string) error {
+	req := syncReq{message: message, done: make(chan error, 1)}
+	if !w.queue.send(req) {
+		w.error(ErrClosed)
+		return ErrClosed
+	}
+	return <-req.done
+}
+
+func (w *FileWriter) handleSync(req syncReq) {
+	var err error
+	if req.message != "" {
+		err = w.log(req.message)
+	}
+	if syncErr := w.sync(); err == nil {
+		err = syncErr
+	}
+	if req.done != nil {
+		req.done <- err
+	}
+}
+
+// sync flushes the buffer and syncs the file, or config.Writer if it is a
+// regular file, if entries were written to it since the last sync.
+func (w *FileWriter) sync() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	file := w.file
+	if file == nil {
+		file = w.writerFile
+	}
+	if file == nil || w.unsynced == 0 {
+		return nil
+	}
+	w.unsynced = 0
+	if err := file.Sync(); err != nil {
+		w.error(err)
+		return err
+	}
+	return nil
+}
+
+func (w *FileWriter) syncLoop() {
+	ticker := time.NewTicker(w.config.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !w.queue.send(syncReq{}) {
+				return
+			}
+		case <-w.queue.closing:
+			return
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPEncoding determines how a batch of entries is encoded in the body of a
+// request sent by an HTTPWriter.
+type HTTPEncoding int
+
+const (
+	// HTTPNDJSON sends one entry per line (newline delimited JSON).
+	HTTPNDJSON HTTPEncoding = iota
+	// HTTPJSONArray sends the entries as elements of a JSON array.
+	HTTPJSONArray
+)
+
+// HTTPWriterConfig configures an HTTPWriter.
+type HTTPWriterConfig struct {
+	// URL is the URL the batches are POSTed to.
+	URL string
+	// Formatter must format entries as JSON objects, e.g. a *JSONFormatter.
+	Formatter Formatter
+	Encoding  HTTPEncoding
+	// Gzip compresses the request bodies.
+	Gzip bool
+	// Header holds additional request headers, e.g. for authentication.
+	Header http.Header
+	// Client sends the requests. A client using Timeout is created if it is
+	// nil.
+	Client  *http.Client
+	Timeout time.Duration
+	// A batch is sent once it holds BatchSize entries or BatchBytes bytes, or
+	// BatchDelay after its first entry was added. 0 disables the respective
+	// limit. Flush sends the current batch regardless of the limits.
+	BatchSize  int
+	BatchBytes int
+	BatchDelay time.Duration
+	// MaxRetries is the number of times a batch is resent after a connection
+	// error or a 429 or 5xx response. RetryInterval is the delay before the
+	// first retry, it is doubled for every following one up to
+	// MaxRetryInterval. A Retry-After header takes precedence over it, but is
+	// limited to MaxRetryInterval as well. Batches are not retried once Close
+	// was called.
+	MaxRetries       int
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+	ErrorHandler     ErrorHandler
+
+	// QueueConfig configures the queue holding the entries while a batch is
+	// being sent.
+	QueueConfig
+}
+
+// NewHTTPWriter returns an *HTTPWriter for config, or an error if config is
+// invalid, see HTTPWriterConfig.Validate. A nil Formatter is replaced with
+// the one of DefaultHTTPWriterConfig.
+func NewHTTPWriter(config HTTPWriterConfig) (*HTTPWriter, error) {
+	if config.Formatter == nil {
+		config.Formatter = DefaultHTTPWriterConfig.Formatter
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: config.Timeout}
+	}
+
+	w := &HTTPWriter{config: config, now: time.Now}
+	queue, err := newQueueFromConfig(config.QueueConfig, w, w.error)
+	if err != nil {
+		return nil, err
+	}
+	w.queue = queue
+	if config.BatchDelay > 0 {
+		w.timer = time.NewTimer(config.BatchDelay)
+		w.timer.Stop()
+		go w.batchLoop()
+	}
+	return w, nil
+}
+
+// HTTPWriter is a Handler that POSTs batches of formatted entries to a URL,
+// e.g. the HTTP endpoint of a log collector.
+type HTTPWriter struct {
+	config HTTPWriterConfig
+	queue  *queue
+	now    func() time.Time
+	// batch holds the messages of the next request, batchBytes their size and
+	// batchStart the time the first one was added. timer triggers sending the
+	// batch after config.BatchDelay.
+	batch      []string
+	batchBytes int
+	batchStart time.Time
+	timer      *time.Timer
+}
+
+// sendReq causes the current batch to be sent if config.BatchDelay has
+// passed since its first entry was added.
+type sendReq struct{}
+
+// Validate returns an error describing the first invalid setting of c, or nil
+// if c is valid.
+func (c HTTPWriterConfig) Validate() error {
+	const config = "HTTPWriterConfig"
+	if c.URL == "" {
+		return invalidConfig(config, "URL must be set")
+	} else if c.Formatter == nil {
+		return invalidConfig(config, "Formatter must be set")
+	} else if c.Encoding < HTTPNDJSON || c.Encoding > HTTPJSONArray {
+		return invalidConfig(config, "Encoding must be a valid HTTPEncoding")
+	}
+
+	err := validateNonNegative(config,
+		configSetting{"Timeout", int64(c.Timeout)},
+		configSetting{"BatchSize", int64(c.BatchSize)},
+		configSetting{"BatchBytes", int64(c.BatchBytes)},
+		configSetting{"BatchDelay", int64(c.BatchDelay)},
+		configSetting{"MaxRetries", int64(c.MaxRetries)},
+		configSetting{"RetryInterval", int64(c.RetryInterval)},
+		configSetting{"MaxRetryInterval", int64(c.MaxRetryInterval)},
+	)
+	if err == nil {
+		err = c.QueueConfig.validate(config)
+	}
+	if err == nil {
+		err = validateRetry(config, c.RetryInterval, c.MaxRetryInterval)
+	}
+	return err
+}
+
+func (w *HTTPWriter) Log(entry Entry) {
+	w.queue.push(w.config.Formatter.Format(entry), entry)
+}
+
+// Flush waits until all queued entries have been sent, including retries.
+func (w *HTTPWriter) Flush() {
+	w.queue.flush()
+}
+
+// Close sends all queued entries and stops the background goroutines. Batches
+// that fail are dropped and reported to the ErrorHandler instead of being
+// retried.
+func (w *HTTPWriter) Close() error {
+	return w.queue.close()
+}
+
+// Name returns the URL written to.
+func (w *HTTPWriter) Name() string {
+	return "HTTPWriter(" + w.config.URL + ")"
+}
+
+func (w *HTTPWriter) handleOp(op interface{}) {
+	switch t := op.(type) {
+	case string:
+		w.add(t)
+	case sendReq:
+		if len(w.batch) == 0 {
+			return
+		}
+		// The timer may have fired for a batch that was already sent.
+		if age := w.now().Sub(w.batchStart); age < w.config.BatchDelay {
+			w.timer.Reset(w.config.BatchDelay - age)
+			return
+		}
+		w.send()
+	}
+}
+
+func (w *HTTPWriter) handleFlush() {
+	w.send()
+}
+
+func (w *HTTPWriter) handleClose() error {
+	w.send()
+	return nil
+}
+
+// add adds message to the current batch, sending it if it is full. A message
+// that would make the batch exceed config.BatchBytes is sent with the next
+// batch.
+func (w *HTTPWriter) add(message string) {
+	message = strings.TrimRight(message, "\n")
+	if w.config.BatchBytes > 0 && len(w.batch) > 0 && w.batchBytes+len(message)+1 > w.config.BatchBytes {
+		w.send()
+	}
+	if len(w.batch) == 0 {
+		w.batchStart = w.now()
+		if w.timer != nil {
+			w.timer.Reset(w.config.BatchDelay)
+		}
+	}
+	w.batch = append(w.batch, message)
+	w.batchBytes += len(message) + 1
+	if w.config.BatchSize > 0 && len(w.batch) >= w.config.BatchSize ||
+		w.config.BatchBytes > 0 && w.batchBytes >= w.config.BatchBytes {
+		w.send()
+	}
+}
+
+// send POSTs the current batch, retrying according to config.MaxRetries. The
+// batch is dropped and reported to the ErrorHandler if all attempts fail, or
+// one fails while the writer is closing.
+func (w *HTTPWriter) send() {
+	if len(w.batch) == 0 {
+		return
+	}
+	batch := w.batch
+	w.batch, w.batchBytes = nil, 0
+
+	body, err := w.encode(batch)
+	if err != nil {
+		w.error(err)
+		return
+	}
+	var delay time.Duration
+	for attempt := 1; ; attempt++ {
+		retryAfter, retry, err := w.post(body)
+		if err == nil {
+			return
+		}
+		w.error(err)
+		if retry && attempt <= w.config.MaxRetries {
+			delay = backoff(delay, w.config.RetryInterval, w.config.MaxRetryInterval)
+			wait := delay
+			if retryAfter > 0 {
+				wait = retryAfter
+				if w.config.MaxRetryInterval > 0 && wait > w.config.MaxRetryInterval {
+					wait = w.config.MaxRetryInterval
+				}
+			}
+			if w.queue.wait(wait) {
+				continue
+			}
+		}
+		w.error(fmt.Errorf("Dropped %d log entries after %d attempts to send them to %s.", len(batch), attempt, w.config.URL))
+		return
+	}
+}
+
+// encode returns the request body for batch.
+func (w *HTTPWriter) encode(batch []string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	var writer io.Writer = buf
+	var gz *gzip.Writer
+	if w.config.Gzip {
+		gz = gzip.NewWriter(buf)
+		writer = gz
+	}
+	if w.config.Encoding == HTTPJSONArray {
+		io.WriteString(writer, "["+strings.Join(batch, ",")+"]")
+	} else {
+		io.WriteString(writer, strings.Join(batch, "\n")+"\n")
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// post sends body. If it fails, it returns whether the request should be
+// retried and the delay requested by a Retry-After header, if any.
+func (w *HTTPWriter) post(body []byte) (time.Duration, bool, error) {
+	req, err := http.NewRequest("POST", w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+	for key, values := range w.config.Header {
+		req.Header[key] = values
+	}
+	if w.config.Encoding == HTTPJSONArray {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	}
+	if w.config.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := w.config.Client.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 300 {
+		return 0, false, nil
+	}
+
+	err = fmt.Errorf("POST %s returned %s.", w.config.URL, resp.Status)
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		return 0, false, err
+	}
+	return w.retryAfter(resp.Header.Get("Retry-After")), true, err
+}
+
+// retryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or an HTTP date.
+func (w *HTTPWriter) retryAfter(header string) time.Duration {
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return t.Sub(w.now())
+	}
+	return 0
+}
+
+func (w *HTTPWriter) batchLoop() {
+	for {
+		select {
+		case <-w.timer.C:
+			if !w.queue.send(sendReq{}) {
+				return
+			}
+		case <-w.queue.closing:
+			return
+		}
+	}
+}
+
+func (w *HTTPWriter) error(err error) {
+	if w.config.ErrorHandler != nil {
+		w.config.ErrorHandler(err)
+	}
+}
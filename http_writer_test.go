@@ -0,0 +1,204 @@
+package log
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// requestRecorder is an http.Handler that records request bodies and responds
+// with the given statuses in order, followed by 200 OK. Error responses have a
+// Retry-After header of retryAfter, or 0 if it is empty.
+type requestRecorder struct {
+	mu         sync.Mutex
+	statuses   []int
+	retryAfter string
+	requests   []*http.Request
+	bodies     []string
+}
+
+func (r *requestRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var body io.Reader = req.Body
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = gz
+	}
+	data, _ := io.ReadAll(body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, string(data))
+	if len(r.statuses) > 0 {
+		if r.retryAfter == "" {
+			w.Header().Set("Retry-After", "0")
+		} else {
+			w.Header().Set("Retry-After", r.retryAfter)
+		}
+		w.WriteHeader(r.statuses[0])
+		r.statuses = r.statuses[1:]
+	}
+}
+
+func (r *requestRecorder) Bodies() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.bodies...)
+}
+
+func TestHTTPWriter(t *testing.T) {
+	var (
+		a = `{"time":"-","level":"info","msg":"A"}`
+		b = `{"time":"-","level":"info","msg":"B"}`
+		c = `{"time":"-","level":"info","msg":"C"}`
+	)
+	tests := []struct {
+		modify     func(c *HTTPWriterConfig)
+		statuses   []int
+		retryAfter string
+		// flush calls Flush after logging A, B and C, otherwise Close is called
+		// once len(bodies) requests were received. URL in errors is replaced
+		// with the URL of the server.
+		flush  bool
+		bodies []string
+		errors []string
+	}{
+		{
+			modify: func(c *HTTPWriterConfig) {
+				c.BatchSize, c.Gzip = 2, true
+				c.Header = http.Header{"Authorization": {"Bearer secret"}}
+			},
+			flush:  true,
+			bodies: []string{a + "\n" + b + "\n", c + "\n"},
+		},
+		{
+			modify:   func(c *HTTPWriterConfig) { c.Encoding = HTTPJSONArray },
+			statuses: []int{503, 429},
+			flush:    true,
+			bodies:   []string{"[" + a + "," + b + "," + c + "]", "[" + a + "," + b + "," + c + "]", "[" + a + "," + b + "," + c + "]"},
+			errors:   []string{"POST URL returned 503 Service Unavailable.", "POST URL returned 429 Too Many Requests."},
+		},
+		{
+			statuses: []int{400},
+			flush:    true,
+			bodies:   []string{a + "\n" + b + "\n" + c + "\n"},
+			errors:   []string{"POST URL returned 400 Bad Request.", "Dropped 3 log entries after 1 attempts to send them to URL."},
+		},
+		// Retry-After is limited to MaxRetryInterval.
+		{
+			statuses:   []int{503},
+			retryAfter: "3600",
+			flush:      true,
+			bodies:     []string{a + "\n" + b + "\n" + c + "\n", a + "\n" + b + "\n" + c + "\n"},
+			errors:     []string{"POST URL returned 503 Service Unavailable."},
+		},
+		// Close interrupts the wait for the next attempt.
+		{
+			modify: func(c *HTTPWriterConfig) {
+				c.BatchDelay = time.Millisecond
+				c.RetryInterval, c.MaxRetryInterval = time.Hour, time.Hour
+			},
+			statuses: []int{503},
+			bodies:   []string{a + "\n" + b + "\n" + c + "\n"},
+			errors:   []string{"POST URL returned 503 Service Unavailable.", "Dropped 3 log entries after 1 attempts to send them to URL."},
+		},
+		// Batches are sent after BatchDelay without flushing.
+		{
+			modify: func(c *HTTPWriterConfig) { c.BatchDelay = 10 * time.Millisecond },
+			bodies: []string{a + "\n" + b + "\n" + c + "\n"},
+		},
+	}
+
+	for i, test := range tests {
+		r := &requestRecorder{statuses: test.statuses, retryAfter: test.retryAfter}
+		server := httptest.NewServer(r)
+		defer server.Close()
+
+		errs := &errorRecorder{}
+		config := DefaultHTTPWriterConfig
+		config.URL = server.URL
+		config.Formatter = &JSONFormatter{TimeLayout: "-"}
+		config.RetryInterval, config.MaxRetryInterval = time.Millisecond, time.Millisecond
+		config.ErrorHandler = errs.Handle
+		if test.modify != nil {
+			test.modify(&config)
+		}
+		w, err := NewHTTPWriter(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w.Log(NewEntry(INFO, "A"))
+		w.Log(NewEntry(INFO, "B"))
+		w.Log(NewEntry(INFO, "C"))
+		if test.flush {
+			w.Flush()
+		}
+		for j := 0; len(r.Bodies()) < len(test.bodies); j++ {
+			if j > 1000 {
+				t.Fatalf("test %d: Batch was not sent", i)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		start := time.Now()
+		w.Close()
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("test %d: Close blocked for %s", i, elapsed)
+		}
+
+		if bodies := r.Bodies(); strings.Join(bodies, "|") != strings.Join(test.bodies, "|") {
+			t.Errorf("test %d: Bad bodies: %q", i, bodies)
+		}
+		var errors []string
+		for _, err := range errs.Errors() {
+			errors = append(errors, strings.ReplaceAll(err.Error(), server.URL, "URL"))
+		}
+		if strings.Join(errors, "|") != strings.Join(test.errors, "|") {
+			t.Errorf("test %d: Bad errors: %q", i, errors)
+		}
+		if i == 0 {
+			r.mu.Lock()
+			header := r.requests[0].Header
+			r.mu.Unlock()
+			if header.Get("Content-Type") != "application/x-ndjson" || header.Get("Authorization") != "Bearer secret" {
+				t.Errorf("Bad headers: %v", header)
+			}
+		}
+	}
+}
+
+func TestHTTPWriterConfig_Validate(t *testing.T) {
+	tests := []struct {
+		modify func(c *HTTPWriterConfig)
+		err    string
+	}{
+		{func(c *HTTPWriterConfig) {}, ""},
+		{func(c *HTTPWriterConfig) { c.URL = "" }, "URL must be set"},
+		{func(c *HTTPWriterConfig) { c.Encoding = -1 }, "Encoding must be a valid HTTPEncoding"},
+		{func(c *HTTPWriterConfig) { c.BatchSize = -1 }, "BatchSize must not be negative"},
+		{func(c *HTTPWriterConfig) { c.Capacity = -1 }, "Capacity must not be negative"},
+		{func(c *HTTPWriterConfig) { c.MaxRetryInterval = time.Millisecond }, "MaxRetryInterval must not be less than RetryInterval"},
+	}
+
+	for _, test := range tests {
+		config := DefaultHTTPWriterConfig
+		config.URL = "http://localhost:8080/logs"
+		test.modify(&config)
+
+		err := config.Validate()
+		if test.err == "" && err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		} else if expected := "Invalid HTTPWriterConfig: " + test.err + "."; test.err != "" && (err == nil || err.Error() != expected) {
+			t.Errorf("Bad error: %v != %s", err, expected)
+		}
+	}
+}
@@ -1,5 +1,10 @@
 package log
 
+import (
+	"fmt"
+	"time"
+)
+
 // Interface defines the log interface provided by this package. Use this when
 // passing *Logger instances around.
 type Interface interface {
@@ -8,6 +13,7 @@ type Interface interface {
 	Warn(args ...interface{})
 	Error(args ...interface{}) error
 	Panic(args ...interface{})
+	Fatal(args ...interface{})
 }
 
 // Handler is used to implement log handlers.
@@ -20,6 +26,20 @@ type Handler interface {
 	Flush()
 }
 
+// Closer is implemented by handlers that hold resources (e.g. files or
+// goroutines) which need to be released when the *Logger using them is closed.
+type Closer interface {
+	// Close flushes any buffered data and releases all resources held by the
+	// handler. Calls to Log after Close do not block.
+	Close() error
+}
+
+// Namer can be implemented by handlers to provide a human readable name that
+// is used in error messages, e.g. by FlushError.
+type Namer interface {
+	Name() string
+}
+
 type Formatter interface {
 	Format(e Entry) string
 }
@@ -33,3 +53,14 @@ type ErrEntryDropped struct {
 func (e *ErrEntryDropped) Error() string {
 	return "Dropped log entry."
 }
+
+// ErrEntriesDropped reports the number of entries dropped during an interval,
+// see the DropReportInterval settings of AsyncConfig and FileWriterConfig.
+type ErrEntriesDropped struct {
+	Count    int
+	Interval time.Duration
+}
+
+func (e *ErrEntriesDropped) Error() string {
+	return fmt.Sprintf("Dropped %d log entries in last %s.", e.Count, e.Interval)
+}
@@ -0,0 +1,210 @@
+//go:build linux
+
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultJournalSocket is the path of the native socket of systemd-journald.
+const DefaultJournalSocket = "/run/systemd/journal/socket"
+
+// DefaultJournalWriteTimeout is the WriteTimeout used by JournalWriter if it
+// is 0.
+const DefaultJournalWriteTimeout = 100 * time.Millisecond
+
+// The journal fields set by JournalWriter for the built-in properties of an
+// Entry. Fields whose sanitized key collides with one of them, or any other
+// key journald treats specially, are prefixed with JournalFieldPrefix.
+const (
+	JournalMessageKey    = "MESSAGE"
+	JournalPriorityKey   = "PRIORITY"
+	JournalFileKey       = "CODE_FILE"
+	JournalLineKey       = "CODE_LINE"
+	JournalFunctionKey   = "CODE_FUNC"
+	JournalIdentifierKey = "SYSLOG_IDENTIFIER"
+	JournalFieldPrefix   = "FIELD_"
+)
+
+// JournalConfig configures a JournalWriter.
+type JournalConfig struct {
+	// Socket is the path of the journal socket. DefaultJournalSocket is used
+	// if it is empty.
+	Socket string
+	// Identifier is the SYSLOG_IDENTIFIER of all entries. The name of the
+	// executable is used if it is empty.
+	Identifier string
+	// WriteTimeout limits how long Log blocks while the receive queue of
+	// journald is full, after which the entry is dropped and the error is
+	// passed to ErrorHandler. DefaultJournalWriteTimeout is used if it is 0.
+	WriteTimeout time.Duration
+	ErrorHandler ErrorHandler
+}
+
+// NewJournalWriter returns a *JournalWriter for the journal socket, or an
+// error if it does not exist, e.g. because the process is not running under
+// systemd.
+func NewJournalWriter(config JournalConfig) (*JournalWriter, error) {
+	if config.Socket == "" {
+		config.Socket = DefaultJournalSocket
+	}
+	if config.Identifier == "" {
+		config.Identifier = filepath.Base(os.Args[0])
+	}
+	if config.WriteTimeout == 0 {
+		config.WriteTimeout = DefaultJournalWriteTimeout
+	}
+	if _, err := os.Stat(config.Socket); err != nil {
+		return nil, err
+	}
+	// The socket is not connected, as file descriptors can only be passed
+	// using WriteMsgUnix with an address.
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	addr := &net.UnixAddr{Name: config.Socket, Net: "unixgram"}
+	return &JournalWriter{config: config, conn: conn, addr: addr}, nil
+}
+
+// JournalWriter is a Handler that writes entries to systemd-journald using
+// its native protocol. Every field of an entry becomes a journal field, with
+// its key uppercased and all characters other than A-Z, 0-9 and '_' replaced
+// by '_'. Entries are written synchronously by the goroutine calling Log,
+// which blocks for up to config.WriteTimeout if journald can not keep up.
+// Entries too large for a datagram are passed as a file descriptor.
+type JournalWriter struct {
+	config JournalConfig
+	conn   *net.UnixConn
+	addr   *net.UnixAddr
+}
+
+func (w *JournalWriter) Log(e Entry) {
+	if err := w.write(w.format(e)); err != nil {
+		w.error(err)
+	}
+}
+
+// Flush does nothing, as entries are not buffered.
+func (w *JournalWriter) Flush() {}
+
+// Close closes the socket used to write to the journal.
+func (w *JournalWriter) Close() error {
+	return w.conn.Close()
+}
+
+// Name returns the path of the journal socket.
+func (w *JournalWriter) Name() string {
+	return "JournalWriter(" + w.config.Socket + ")"
+}
+
+// format returns e serialized according to the native journal protocol.
+func (w *JournalWriter) format(e Entry) []byte {
+	buf := &bytes.Buffer{}
+	writeJournalField(buf, JournalMessageKey, e.Message)
+	writeJournalField(buf, JournalPriorityKey, strconv.Itoa(syslogSeverity(e.Level)))
+	writeJournalField(buf, JournalIdentifierKey, w.config.Identifier)
+	if len(e.Stack) > 0 {
+		writeJournalField(buf, JournalFileKey, e.File())
+		writeJournalField(buf, JournalLineKey, strconv.Itoa(e.Line()))
+		writeJournalField(buf, JournalFunctionKey, e.Function())
+	}
+	for _, field := range e.Fields {
+		writeJournalField(buf, journalKey(field.Key), fieldString(field.Value))
+	}
+	return buf.Bytes()
+}
+
+// journalReservedKeys holds the keys set by JournalWriter as well as other
+// keys with a special meaning to journald.
+var journalReservedKeys = map[string]bool{
+	JournalMessageKey:    true,
+	JournalPriorityKey:   true,
+	JournalFileKey:       true,
+	JournalLineKey:       true,
+	JournalFunctionKey:   true,
+	JournalIdentifierKey: true,
+	"MESSAGE_ID":         true,
+	"SYSLOG_FACILITY":    true,
+	"SYSLOG_PID":         true,
+	"ERRNO":              true,
+}
+
+// journalKey returns key as a valid journal field name. Journal field names
+// consist of up to 64 uppercase letters, digits and underscores and must not
+// start with a digit or underscore.
+func journalKey(key string) string {
+	key = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return '_'
+	}, key)
+	if key == "" || key[0] == '_' || key[0] >= '0' && key[0] <= '9' || journalReservedKeys[key] {
+		key = JournalFieldPrefix + key
+	}
+	if len(key) > 64 {
+		key = key[:64]
+	}
+	return key
+}
+
+// writeJournalField writes a field in the form KEY=value followed by a
+// newline, or using the binary form if value contains a newline.
+func writeJournalField(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(key)
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// write sends data as a single datagram, or writes it to an unlinked
+// temporary file whose descriptor is sent instead if it is too large.
+func (w *JournalWriter) write(data []byte) error {
+	w.conn.SetWriteDeadline(time.Now().Add(w.config.WriteTimeout))
+	_, err := w.conn.WriteToUnix(data, w.addr)
+	if !errors.Is(err, syscall.EMSGSIZE) && !errors.Is(err, syscall.ENOBUFS) {
+		return err
+	}
+
+	file, err := os.CreateTemp("/dev/shm", "journal-")
+	if err != nil {
+		if file, err = os.CreateTemp("", "journal-"); err != nil {
+			return err
+		}
+	}
+	defer file.Close()
+	if err := os.Remove(file.Name()); err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+	_, _, err = w.conn.WriteMsgUnix(nil, syscall.UnixRights(int(file.Fd())), w.addr)
+	return err
+}
+
+func (w *JournalWriter) error(err error) {
+	if w.config.ErrorHandler != nil {
+		w.config.ErrorHandler(err)
+	}
+}
@@ -0,0 +1,116 @@
+//go:build linux
+
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestJournalWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	errs := &errorRecorder{}
+	w, err := NewJournalWriter(JournalConfig{Socket: path, Identifier: "test", ErrorHandler: errs.Handle})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	e := NewEntryWithStack(WARN, 2, 1, "Hello", Context{"user.id": 5, "message": "x", "_uid": 0, "multi": "a\nb"})
+	w.Log(e)
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	multi := &bytes.Buffer{}
+	multi.WriteString("MULTI\n")
+	binary.Write(multi, binary.LittleEndian, uint64(3))
+	multi.WriteString("a\nb\n")
+	expected := "MESSAGE=Hello\nPRIORITY=4\nSYSLOG_IDENTIFIER=test\n" +
+		"CODE_FILE=" + e.File() + "\nCODE_LINE=" + strconv.Itoa(e.Line()) + "\nCODE_FUNC=" + e.Function() + "\n" +
+		"FIELD__UID=0\nFIELD_MESSAGE=x\n" + multi.String() + "USER_ID=5\n"
+	if string(buf[:n]) != expected {
+		t.Errorf("Bad datagram:\n%q\n%q", buf[:n], expected)
+	}
+
+	// Messages too large for a datagram are passed as a file descriptor.
+	large := strings.Repeat("x", 1<<20)
+	w.Log(NewEntry(INFO, large))
+	oob := make([]byte, syscall.CmsgSpace(4))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("Bad control messages: %v %v", messages, err)
+	}
+	fds, err := syscall.ParseUnixRights(&messages[0])
+	if err != nil || len(fds) != 1 {
+		t.Fatalf("Bad rights: %v %v", fds, err)
+	}
+	file := os.NewFile(uintptr(fds[0]), "journal")
+	defer file.Close()
+	file.Seek(0, io.SeekStart)
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "MESSAGE="+large+"\nPRIORITY=6\n") {
+		t.Errorf("Bad file data: %.64q", data)
+	}
+	if errors := errs.Errors(); len(errors) != 0 {
+		t.Errorf("Unexpected errors: %v", errors)
+	}
+	if _, err := NewJournalWriter(JournalConfig{Socket: path + ".missing"}); err == nil {
+		t.Errorf("Expected error for missing socket")
+	}
+}
+
+func TestJournalWriter_timeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// conn is never read from, so its receive queue fills up.
+	errs := &errorRecorder{}
+	config := JournalConfig{Socket: path, WriteTimeout: time.Millisecond, ErrorHandler: errs.Handle}
+	w, err := NewJournalWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	start := time.Now()
+	for i := 0; i < 100000 && len(errs.Errors()) == 0; i++ {
+		w.Log(NewEntry(INFO, "A"))
+	}
+	if reported := errs.Errors(); len(reported) != 1 || !errors.Is(reported[0], os.ErrDeadlineExceeded) {
+		t.Errorf("Bad errors: %v", reported)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Log blocked for %s", elapsed)
+	}
+}
@@ -0,0 +1,123 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// The keys used by JSONFormatter for the built-in properties of an Entry.
+// Fields using one of these keys are prefixed with FieldKeyPrefix.
+const (
+	JSONTimeKey     = "time"
+	JSONLevelKey    = "level"
+	JSONMessageKey  = "msg"
+	JSONFileKey     = "file"
+	JSONLineKey     = "line"
+	JSONFunctionKey = "func"
+)
+
+// FieldKeyPrefix is prepended to the key of a field that collides with a key
+// reserved by a Formatter, e.g. a "level" field becomes "fields.level".
+const FieldKeyPrefix = "fields."
+
+// NewJSONFormatter returns a *JSONFormatter that formats times using the
+// given layout, e.g. time.RFC3339Nano.
+func NewJSONFormatter(layout string) *JSONFormatter {
+	return &JSONFormatter{TimeLayout: layout}
+}
+
+// JSONFormatter formats entries as JSON objects terminated by a newline. The
+// object holds the time, level, message and call site of the entry, followed
+// by its Fields in order. Field values are encoded with encoding/json, except
+// for errors which are encoded as their Error() string. Values that can not be
+// encoded are replaced by a string describing the encoding error.
+type JSONFormatter struct {
+	// TimeLayout is the layout passed to time.Time.Format.
+	TimeLayout string
+	// TimePrecision truncates times to a multiple of the given duration
+	// (e.g. time.Millisecond) if it is not 0.
+	TimePrecision time.Duration
+	// UTC converts times to UTC before formatting them.
+	UTC bool
+}
+
+func (f *JSONFormatter) Format(e Entry) string {
+	t := e.Time
+	if f.TimePrecision > 0 {
+		t = t.Truncate(f.TimePrecision)
+	}
+	if f.UTC {
+		t = t.UTC()
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	writeJSONPair(buf, JSONTimeKey, t.Format(f.TimeLayout))
+	buf.WriteByte(',')
+	writeJSONPair(buf, JSONLevelKey, e.Level.String())
+	buf.WriteByte(',')
+	writeJSONPair(buf, JSONMessageKey, e.Message)
+	if len(e.Stack) > 0 {
+		buf.WriteByte(',')
+		writeJSONPair(buf, JSONFileKey, e.File())
+		buf.WriteByte(',')
+		writeJSONPair(buf, JSONLineKey, e.Line())
+		buf.WriteByte(',')
+		writeJSONPair(buf, JSONFunctionKey, e.Function())
+	}
+	for _, field := range e.Fields {
+		buf.WriteByte(',')
+		writeJSONPair(buf, fieldKey(e.Fields, field.Key, jsonReservedKeys), field.Value)
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+var jsonReservedKeys = map[string]bool{
+	JSONTimeKey:     true,
+	JSONLevelKey:    true,
+	JSONMessageKey:  true,
+	JSONFileKey:     true,
+	JSONLineKey:     true,
+	JSONFunctionKey: true,
+}
+
+// fieldKey returns key prefixed with FieldKeyPrefix as often as needed to not
+// collide with any of the reserved keys or the keys of fields.
+func fieldKey(fields Fields, key string, reserved map[string]bool) string {
+	if !reserved[key] {
+		return key
+	}
+	for {
+		key = FieldKeyPrefix + key
+		if _, ok := fields.Get(key); !ok && !reserved[key] {
+			return key
+		}
+	}
+}
+
+func writeJSONPair(buf *bytes.Buffer, key string, val interface{}) {
+	writeJSON(buf, key)
+	buf.WriteByte(':')
+	if err, ok := val.(error); ok {
+		val = err.Error()
+	}
+	if err := writeJSON(buf, val); err != nil {
+		writeJSON(buf, fmt.Sprintf("!ERROR(%s): %#v", err, val))
+	}
+}
+
+// writeJSON appends the JSON encoding of val without HTML escaping to buf, or
+// leaves buf unmodified and returns an error if val can not be encoded.
+func writeJSON(buf *bytes.Buffer, val interface{}) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(val); err != nil {
+		return err
+	}
+	buf.Write(bytes.TrimRight(b.Bytes(), "\n"))
+	return nil
+}
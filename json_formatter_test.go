@@ -0,0 +1,44 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJSONFormatterFormat(t *testing.T) {
+	e := Entry{
+		Time:    time.Date(2014, 1, 2, 3, 4, 5, 678901234, time.FixedZone("CET", 3600)),
+		Level:   WARN,
+		Message: "<foo>",
+		Fields: Fields{
+			{"b", 1.5},
+			{"level", "x"},
+			{"fields.level", "y"},
+			{"err", errors.New("oh no")},
+			{"fn", func() {}},
+			{"a", map[string]int{"c": 1}},
+		},
+		Stack: []StackFrame{{file: "bar.go", line: 23, function: "foo.bar"}},
+	}
+
+	f := &JSONFormatter{TimeLayout: time.RFC3339Nano, TimePrecision: time.Millisecond, UTC: true}
+	str := f.Format(e)
+	expected := `{"time":"2014-01-02T02:04:05.678Z","level":"warn","msg":"<foo>",` +
+		`"file":"bar.go","line":23,"func":"foo.bar","b":1.5,` +
+		`"fields.fields.level":"x","fields.level":"y","err":"oh no",` +
+		`"fn":"!ERROR(json: unsupported type: func()): (func())(`
+	if len(str) < len(expected) || str[:len(expected)] != expected {
+		t.Fatalf("Bad result: %s", str)
+	}
+	expectedEnd := `)","a":{"c":1}}` + "\n"
+	if str[len(str)-len(expectedEnd):] != expectedEnd {
+		t.Errorf("Bad result: %s", str)
+	}
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(str), &obj); err != nil {
+		t.Errorf("Invalid JSON: %s", err)
+	}
+}
@@ -33,6 +33,7 @@ const (
 	WARN               // Undesireable event (e.g. invalid user input)
 	ERROR              // E-mail somebody (e.g. could not save record)
 	PANIC              // Call somebody (e.g. database down)
+	FATAL              // Exit the process (e.g. invalid configuration)
 )
 
 var levels = map[Level]string{
@@ -41,4 +42,5 @@ var levels = map[Level]string{
 	WARN:  "warn",
 	ERROR: "error",
 	PANIC: "panic",
+	FATAL: "fatal",
 }
@@ -66,7 +66,7 @@ func (f *LineFormatter) Format(e Entry) string {
 		case "function":
 			val = e.Function()
 		case "message":
-			val = f.formatMessage(e.Args)
+			val = f.formatMessage(e)
 		}
 		args[i] = val
 	}
@@ -78,27 +78,20 @@ func (f *LineFormatter) Format(e Entry) string {
 	return fmt.Sprintf(layout, args...) + "\n"
 }
 
-func (f *LineFormatter) formatMessage(args []interface{}) string {
-	fullContext := Context{}
-	for i, arg := range args {
-		if context, ok := arg.(Context); ok {
-			for key, val := range context {
-				fullContext[key] = val
-			}
-			args = append(args[0:i], args[i+1:]...)
-		}
-	}
-	contextString := ""
-	for key, val := range fullContext {
-		contextString += " " + key + "=" + fmt.Sprint(val)
+// formatMessage returns the Message of e followed by its Fields. Entries that
+// were created as struct literals with only Args are formatted from their Args
+// instead.
+func (f *LineFormatter) formatMessage(e Entry) string {
+	message, fields := e.Message, e.Fields
+	if message == "" && len(e.Args) > 0 {
+		var argFields Fields
+		message, argFields = splitArgs(e.Args)
+		fields = fields.Merge(argFields)
 	}
-
-	if len(args) > 0 {
-		if formatMessage, ok := args[0].(string); ok {
-			return fmt.Sprintf(formatMessage, args[1:]...)+contextString
-		}
+	for _, field := range fields {
+		message += " " + field.Key + "=" + fmt.Sprint(field.Value)
 	}
-	return fmt.Sprint(args...) + contextString
+	return message
 }
 
 // 2006/01/02 15:04:05.000 level message file/line/function
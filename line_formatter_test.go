@@ -33,9 +33,9 @@ func TestLineFormatterFormat_defaultLayout(t *testing.T) {
 func TestLineFormatterFormat_customFormat(t *testing.T) {
 	message := "foo"
 	e := Entry{
-		Time:     time.Now(),
-		Level:    INFO,
-		Args:     []interface{}{message},
+		Time:  time.Now(),
+		Level: INFO,
+		Args:  []interface{}{message},
 		Stack: []StackFrame{{file: "bar.go", line: 23, function: "foo.bar"}},
 	}
 
@@ -0,0 +1,153 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The keys used by LogfmtFormatter for the built-in properties of an Entry.
+// Fields using one of these keys are prefixed with FieldKeyPrefix.
+const (
+	LogfmtTimeKey    = "ts"
+	LogfmtLevelKey   = "level"
+	LogfmtMessageKey = "msg"
+	LogfmtCallerKey  = "caller"
+)
+
+// NewLogfmtFormatter returns a *LogfmtFormatter that formats times using the
+// given layout, e.g. time.RFC3339Nano.
+func NewLogfmtFormatter(layout string) *LogfmtFormatter {
+	return &LogfmtFormatter{TimeLayout: layout}
+}
+
+// LogfmtFormatter formats entries as logfmt lines, e.g.
+//
+//	ts=2014-01-02T03:04:05.678Z level=info msg="User login" caller=main.go:23 user_id=5
+//
+// Fields are written in the order of Entry.Fields, which is the insertion order
+// of bound contexts followed by the sorted keys of Context arguments. Values are
+// quoted and escaped if they are empty or contain spaces, '=', '"' or
+// non-printable characters. Invalid characters in keys are replaced by '_', and
+// keys that clash with a built-in or previous key are prefixed with
+// FieldKeyPrefix, so every key appears only once per line.
+type LogfmtFormatter struct {
+	// TimeLayout is the layout passed to time.Time.Format.
+	TimeLayout string
+	// TimePrecision truncates times to a multiple of the given duration
+	// (e.g. time.Millisecond) if it is not 0.
+	TimePrecision time.Duration
+	// UTC converts times to UTC before formatting them.
+	UTC bool
+}
+
+func (f *LogfmtFormatter) Format(e Entry) string {
+	t := e.Time
+	if f.TimePrecision > 0 {
+		t = t.Truncate(f.TimePrecision)
+	}
+	if f.UTC {
+		t = t.UTC()
+	}
+
+	buf := &bytes.Buffer{}
+	writeLogfmtPair(buf, LogfmtTimeKey, t.Format(f.TimeLayout))
+	buf.WriteByte(' ')
+	writeLogfmtPair(buf, LogfmtLevelKey, e.Level.String())
+	buf.WriteByte(' ')
+	writeLogfmtPair(buf, LogfmtMessageKey, e.Message)
+	if len(e.Stack) > 0 {
+		buf.WriteByte(' ')
+		caller := filepath.Base(e.File()) + ":" + strconv.Itoa(e.Line())
+		writeLogfmtPair(buf, LogfmtCallerKey, caller)
+	}
+	// Distinct keys like "user id" and "user_id" are the same once invalid
+	// characters are replaced, so clashes are checked against the keys
+	// written so far.
+	written := make(map[string]bool, len(logfmtReservedKeys)+len(e.Fields))
+	for key := range logfmtReservedKeys {
+		written[key] = true
+	}
+	for _, field := range e.Fields {
+		buf.WriteByte(' ')
+		key := logfmtKey(field.Key)
+		for written[key] {
+			key = FieldKeyPrefix + key
+		}
+		written[key] = true
+		writeLogfmtPair(buf, key, field.Value)
+	}
+	buf.WriteByte('\n')
+	return buf.String()
+}
+
+var logfmtReservedKeys = map[string]bool{
+	LogfmtTimeKey:    true,
+	LogfmtLevelKey:   true,
+	LogfmtMessageKey: true,
+	LogfmtCallerKey:  true,
+}
+
+// logfmtKey replaces all characters that are not allowed in logfmt keys with
+// '_'.
+func logfmtKey(key string) string {
+	if key == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError || !unicode.IsPrint(r) {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+func writeLogfmtPair(buf *bytes.Buffer, key string, val interface{}) {
+	buf.WriteString(key)
+	buf.WriteByte('=')
+	buf.WriteString(logfmtValue(val))
+}
+
+// logfmtValue returns the string representation of val, quoted if needed.
+func logfmtValue(val interface{}) string {
+	str := fieldString(val)
+	if needsQuoting(str) {
+		return strconv.Quote(str)
+	}
+	return str
+}
+
+// fieldString returns the unquoted string representation of a field value.
+func fieldString(val interface{}) string {
+	switch t := val.(type) {
+	case nil:
+		return "null"
+	case string:
+		return t
+	case []byte:
+		return string(t)
+	case error:
+		return t.Error()
+	case fmt.Stringer:
+		return t.String()
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+func needsQuoting(str string) bool {
+	if str == "" {
+		return true
+	}
+	for _, r := range str {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == utf8.RuneError || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package log
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLogfmtFormatterFormat(t *testing.T) {
+	e := Entry{
+		Time:    time.Date(2014, 1, 2, 3, 4, 5, 678901234, time.UTC),
+		Level:   INFO,
+		Message: "User login",
+		Fields: Fields{
+			{"user id", 5},
+			{"user_id", 6},
+			{"msg", "a=b"},
+			{"quote", `say "hi"`},
+			{"empty", ""},
+			{"nil", nil},
+			{"err", errors.New("line1\nline2")},
+			{"dur", time.Second},
+		},
+		Stack: []StackFrame{{file: "/src/foo/bar.go", line: 23, function: "foo.bar"}},
+	}
+
+	f := &LogfmtFormatter{TimeLayout: time.RFC3339Nano, TimePrecision: time.Millisecond}
+	str := f.Format(e)
+	expected := `ts=2014-01-02T03:04:05.678Z level=info msg="User login" caller=bar.go:23 ` +
+		`user_id=5 fields.user_id=6 fields.msg="a=b" quote="say \"hi\"" empty="" nil=null ` +
+		`err="line1\nline2" dur=1s` + "\n"
+	if str != expected {
+		t.Errorf("Bad result:\n%s\n%s", str, expected)
+	}
+}
@@ -1,22 +1,35 @@
 package log
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var (
 	ErrFlushTimeout = errors.New("Flush timed out.")
+	ErrClosed       = errors.New("Handler is closed.")
 )
 
 type Config struct {
+	// FlushTimeout limits how long Flush waits for the handlers to finish.
+	// Flush waits forever if it is 0.
 	FlushTimeout time.Duration
+	// ExitCode is the status code Fatal exits with. 1 is used if it is 0.
+	ExitCode int
+	// Exit is called by Fatal to terminate the process. os.Exit is used if it
+	// is nil.
+	Exit func(code int)
 }
 
 func NewLogger(config Config, handlers ...Handler) *Logger {
 	l := &Logger{config: config}
+	l.minLevel.Store(int64(noLevel))
 	for _, h := range handlers {
 		l.Handle(DEBUG, h)
 	}
@@ -24,11 +37,28 @@ func NewLogger(config Config, handlers ...Handler) *Logger {
 }
 
 type Logger struct {
-	config   Config
+	config Config
+	// handlers is replaced instead of modified when a handler is added,
+	// removed or changed, so Log can use it without holding mu.
+	mu       sync.RWMutex
 	handlers []*logHandler
+	lastID   HandlerID
+	// minLevel is the lowest level of all handlers, see Enabled.
+	minLevel atomic.Int64
+	// root is the *Logger owning the handlers of a child logger created by
+	// With, or nil if this is a root logger.
+	root   *Logger
+	fields Fields
 }
 
+// noLevel is greater than all valid levels, so no level is enabled for it.
+const noLevel = FATAL + 1
+
+// HandlerID identifies a handler registered with Logger.Handle.
+type HandlerID uint64
+
 type logHandler struct {
+	id      HandlerID
 	lvl     Level
 	handler Handler
 }
@@ -39,64 +69,314 @@ func NewError(e Entry) error {
 	return errors.New(message)
 }
 
+// With returns a child logger that shares the handlers of l, but adds the
+// given context to the Fields of every Entry it logs. Context passed as an
+// argument to a log call takes precedence over the bound context.
+func (l *Logger) With(context Context) *Logger {
+	fields := l.fields.Merge(context.Fields())
+	return &Logger{config: l.config, root: l.base(), fields: fields}
+}
+
+// base returns the *Logger owning the handlers of l.
+func (l *Logger) base() *Logger {
+	if l.root != nil {
+		return l.root
+	}
+	return l
+}
+
+// Enabled returns true if at least one handler is registered for the given
+// level. Log calls below all handler levels return without creating an Entry.
+func (l *Logger) Enabled(lvl Level) bool {
+	return int64(lvl) >= l.base().minLevel.Load()
+}
+
 // Debug logs at the Debug level.
 func (l *Logger) Debug(args ...interface{}) {
-	l.Log(NewEntryWithStack(DEBUG, 3, 1, args...))
+	if l.Enabled(DEBUG) {
+		l.Log(NewEntryWithStack(DEBUG, 3, 1, args...))
+	}
 }
 
 // Debug logs at the Info level.
 func (l *Logger) Info(args ...interface{}) {
-	l.Log(NewEntryWithStack(INFO, 3, 1, args...))
+	if l.Enabled(INFO) {
+		l.Log(NewEntryWithStack(INFO, 3, 1, args...))
+	}
 }
 
 // Warn logs at the Warn level.
 func (l *Logger) Warn(args ...interface{}) {
-	l.Log(NewEntryWithStack(WARN, 3, 1, args...))
+	if l.Enabled(WARN) {
+		l.Log(NewEntryWithStack(WARN, 3, 1, args...))
+	}
 }
 
 // Error logs at the Error level and returns the formatted error message as
 // an error for convenience.
 func (l *Logger) Error(args ...interface{}) error {
+	if !l.Enabled(ERROR) {
+		return NewError(NewEntry(ERROR, args...))
+	}
 	e := NewEntryWithStack(ERROR, 3, 1, args...)
 	l.Log(e)
 	return NewError(e)
 }
 
-// Panic logs at the Panic level, calls Flush() and then os.Exit(1).
+// Panic logs at the Panic level, calls Flush() and then panics with the
+// formatted error message as an error.
 func (l *Logger) Panic(args ...interface{}) {
-	e := NewEntryWithStack(PANIC, 3, 1, args...)
+	l.panic(NewEntryWithStack(PANIC, 3, 1, args...))
+}
+
+// Fatal logs at the Fatal level, calls Flush() and then exits the process
+// using Config.Exit and Config.ExitCode.
+func (l *Logger) Fatal(args ...interface{}) {
+	l.fatal(NewEntryWithStack(FATAL, 3, 1, args...))
+}
+
+func (l *Logger) panic(e Entry) {
 	l.Log(e)
+	l.Flush()
 	panic(NewError(e))
 }
 
+func (l *Logger) fatal(e Entry) {
+	l.Log(e)
+	l.Flush()
+
+	code := l.config.ExitCode
+	if code == 0 {
+		code = 1
+	}
+	if l.config.Exit != nil {
+		l.config.Exit(code)
+		return
+	}
+	os.Exit(code)
+}
+
+// Flush calls FlushContext with a context that times out after
+// Config.FlushTimeout, or never if FlushTimeout is 0. The returned error
+// matches ErrFlushTimeout according to errors.Is if the timeout was reached.
 func (l *Logger) Flush() error {
-	var wg sync.WaitGroup
-	for _, h := range l.handlers {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			h.handler.Flush()
-		}()
+	ctx := context.Background()
+	if l.config.FlushTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.config.FlushTimeout)
+		defer cancel()
+	}
+	return l.FlushContext(ctx)
+}
+
+// FlushContext flushes all handlers concurrently and waits for them to
+// finish. If ctx is done before that, it returns a *FlushError listing the
+// handlers that are still flushing.
+func (l *Logger) FlushContext(ctx context.Context) error {
+	return l.base().eachHandler(ctx, func(h Handler) error {
+		h.Flush()
+		return nil
+	})
+}
+
+// Close closes all handlers implementing Closer and flushes all others,
+// concurrently. Errors returned by Close are reported along with the name of
+// their handler. If ctx is done before all handlers have finished, a
+// *FlushError listing the pending handlers is returned as well.
+func (l *Logger) Close(ctx context.Context) error {
+	return l.base().eachHandler(ctx, func(h Handler) error {
+		if closer, ok := h.(Closer); ok {
+			return closer.Close()
+		}
+		h.Flush()
+		return nil
+	})
+}
+
+// eachHandler calls fn for all handlers concurrently and waits until all calls
+// have returned or ctx is done. Calls that are still running when ctx is done
+// are left to finish in the background.
+func (l *Logger) eachHandler(ctx context.Context, fn func(Handler) error) error {
+	type result struct {
+		i   int
+		err error
 	}
 
-	err := make(chan error, 1)
-	go func() {
-		wg.Wait()
-		err <- nil
-	}()
-	go func() {
-		time.Sleep(l.config.FlushTimeout)
-		err <- ErrFlushTimeout
-	}()
-	return <-err
+	var (
+		handlers = l.getHandlers()
+		finished = make([]bool, len(handlers))
+		results  = make(chan result, len(handlers))
+		errs     []error
+	)
+	for i, h := range handlers {
+		go func(i int, h Handler) {
+			results <- result{i, fn(h)}
+		}(i, h.handler)
+	}
+
+	for remaining := len(handlers); remaining > 0; remaining-- {
+		select {
+		case r := <-results:
+			finished[r.i] = true
+			if r.err != nil {
+				name := HandlerName(handlers[r.i].handler)
+				errs = append(errs, fmt.Errorf("%s: %w", name, r.err))
+			}
+		case <-ctx.Done():
+			flushErr := &FlushError{Err: ctx.Err()}
+			for i, h := range handlers {
+				if !finished[i] {
+					pending := PendingHandler{ID: h.id, Name: HandlerName(h.handler)}
+					flushErr.Pending = append(flushErr.Pending, pending)
+				}
+			}
+			if len(errs) == 0 {
+				return flushErr
+			}
+			return errors.Join(append([]error{flushErr}, errs...)...)
+		}
+	}
+	return errors.Join(errs...)
 }
 
-func (l *Logger) Handle(lvl Level, handler Handler) {
-	l.handlers = append(l.handlers, &logHandler{lvl, handler})
+// FlushError is returned by Logger.FlushContext and Logger.Close if the
+// context is done before all handlers have finished.
+type FlushError struct {
+	// Pending holds the handlers that did not finish in time.
+	Pending []PendingHandler
+	// Err is the error returned by ctx.Err().
+	Err error
+}
+
+// PendingHandler describes a handler that did not finish flushing in time.
+type PendingHandler struct {
+	ID   HandlerID
+	Name string
+}
+
+func (e *FlushError) Error() string {
+	names := make([]string, len(e.Pending))
+	for i, pending := range e.Pending {
+		names[i] = pending.Name
+	}
+	return fmt.Sprintf("Flush did not finish: %s. Pending handlers: %s.", e.Err, strings.Join(names, ", "))
+}
+
+func (e *FlushError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports ErrFlushTimeout as the target if e was caused by a deadline.
+func (e *FlushError) Is(target error) bool {
+	return target == ErrFlushTimeout && e.Err == context.DeadlineExceeded
+}
+
+// HandlerName returns the name of h if it implements Namer, or its type
+// otherwise.
+func HandlerName(h Handler) string {
+	if namer, ok := h.(Namer); ok {
+		return namer.Name()
+	}
+	return fmt.Sprintf("%T", h)
+}
+
+// Handle registers handler for entries at or above the given level and
+// returns an ID that can be used to change or remove it later. It is safe to
+// call Handle while other goroutines are logging.
+func (l *Logger) Handle(lvl Level, handler Handler) HandlerID {
+	l = l.base()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.lastID++
+	h := &logHandler{id: l.lastID, lvl: lvl, handler: handler}
+	l.setHandlers(append(l.handlers[0:len(l.handlers):len(l.handlers)], h))
+	return h.id
+}
+
+// RemoveHandler unregisters the handler with the given id. It returns false if
+// no such handler is registered.
+func (l *Logger) RemoveHandler(id HandlerID) bool {
+	l = l.base()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, h := range l.handlers {
+		if h.id == id {
+			handlers := make([]*logHandler, 0, len(l.handlers)-1)
+			handlers = append(handlers, l.handlers[0:i]...)
+			l.setHandlers(append(handlers, l.handlers[i+1:]...))
+			return true
+		}
+	}
+	return false
+}
+
+// ReplaceHandlers atomically unregisters all handlers and registers the given
+// handlers at the given level instead. It returns the IDs of the new
+// handlers.
+func (l *Logger) ReplaceHandlers(lvl Level, handlers ...Handler) []HandlerID {
+	l = l.base()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ids := make([]HandlerID, len(handlers))
+	logHandlers := make([]*logHandler, len(handlers))
+	for i, handler := range handlers {
+		l.lastID++
+		ids[i] = l.lastID
+		logHandlers[i] = &logHandler{id: l.lastID, lvl: lvl, handler: handler}
+	}
+	l.setHandlers(logHandlers)
+	return ids
+}
+
+// SetHandlerLevel changes the level of the handler with the given id. It
+// returns false if no such handler is registered.
+func (l *Logger) SetHandlerLevel(id HandlerID, lvl Level) bool {
+	l = l.base()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, h := range l.handlers {
+		if h.id == id {
+			handlers := make([]*logHandler, len(l.handlers))
+			copy(handlers, l.handlers)
+			handlers[i] = &logHandler{id: h.id, lvl: lvl, handler: h.handler}
+			l.setHandlers(handlers)
+			return true
+		}
+	}
+	return false
+}
+
+// setHandlers replaces the registered handlers and updates minLevel. The
+// caller must hold mu.
+func (l *Logger) setHandlers(handlers []*logHandler) {
+	minLevel := noLevel
+	for _, h := range handlers {
+		if h.lvl < minLevel {
+			minLevel = h.lvl
+		}
+	}
+	l.handlers = handlers
+	l.minLevel.Store(int64(minLevel))
+}
+
+// getHandlers returns the currently registered handlers. The returned slice
+// must not be modified.
+func (l *Logger) getHandlers() []*logHandler {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.handlers
 }
 
 func (l *Logger) Log(e Entry) {
-	for _, h := range l.handlers {
+	if l.root != nil {
+		e.Fields = l.fields.Merge(e.Fields)
+		l = l.root
+	}
+	for _, h := range l.getHandlers() {
 		if e.Level >= h.lvl {
 			h.handler.Log(e)
 		}
@@ -1,9 +1,13 @@
 package log
 
 import (
+	"context"
+	"errors"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestLogger(t *testing.T) {
@@ -35,6 +39,178 @@ func TestLogger(t *testing.T) {
 	}
 }
 
+func TestLogger_With(t *testing.T) {
+	l, w := NewTestLogger()
+
+	child := l.With(Context{"request_id": 1, "user_id": 2})
+	child.Info("Test A", Context{"user_id": 3})
+	child.With(Context{"b": 4}).Info("Test B")
+	l.Info("Test C")
+
+	if !w.MatchLevel("^Test A request_id=1 user_id=3$", INFO) {
+		t.Errorf("Missing entry: A")
+	}
+	if !w.MatchLevel("^Test B request_id=1 user_id=2 b=4$", INFO) {
+		t.Errorf("Missing entry: B")
+	}
+	if !w.MatchLevel("^Test C$", INFO) {
+		t.Errorf("Missing entry: C")
+	}
+}
+
+// countHandler is a Handler that counts the entries it receives.
+type countHandler struct {
+	count int64
+}
+
+func (h *countHandler) Log(e Entry) {
+	atomic.AddInt64(&h.count, 1)
+}
+
+func (h *countHandler) Flush() {}
+
+func (h *countHandler) Count() int {
+	return int(atomic.LoadInt64(&h.count))
+}
+
+func TestLogger_handlers(t *testing.T) {
+	var (
+		l    = NewLogger(DefaultConfig)
+		a    = &countHandler{}
+		b    = &countHandler{}
+		c    = &countHandler{}
+		idA  = l.Handle(DEBUG, a)
+		idB  = l.With(Context{"foo": 1}).Handle(INFO, b)
+		done = make(chan struct{})
+		wg   sync.WaitGroup
+	)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				l.Debug("concurrent")
+			}
+		}
+	}()
+
+	if !l.SetHandlerLevel(idA, WARN) {
+		t.Errorf("SetHandlerLevel failed")
+	}
+	close(done)
+	wg.Wait()
+	countA, countB := a.Count(), b.Count()
+
+	l.Debug("A")
+	l.Info("B")
+	if a.Count() != countA || b.Count() != countB+1 {
+		t.Errorf("Bad counts: %d %d", a.Count()-countA, b.Count()-countB)
+	}
+
+	if !l.RemoveHandler(idB) || l.RemoveHandler(idB) {
+		t.Errorf("RemoveHandler failed")
+	}
+	l.Warn("C")
+	if a.Count() != countA+1 || b.Count() != countB+1 {
+		t.Errorf("Bad counts: %d %d", a.Count()-countA, b.Count()-countB)
+	}
+
+	ids := l.ReplaceHandlers(ERROR, c)
+	if len(ids) != 1 || ids[0] == idA || ids[0] == idB {
+		t.Errorf("Bad ids: %v", ids)
+	}
+	l.Warn("D")
+	l.Error("E")
+	if a.Count() != countA+1 || c.Count() != 1 {
+		t.Errorf("Bad counts: %d %d", a.Count()-countA, c.Count())
+	}
+	if l.SetHandlerLevel(idA, DEBUG) {
+		t.Errorf("SetHandlerLevel succeeded for removed handler")
+	}
+}
+
+func TestLogger_Enabled(t *testing.T) {
+	l := NewLogger(DefaultConfig)
+	if l.Enabled(FATAL) {
+		t.Errorf("Enabled without handlers")
+	}
+	if err := l.Error("Test %d", 1); err.Error() != "Test 1" {
+		t.Errorf("Bad error return: %s", err)
+	}
+
+	id := l.Handle(WARN, NewTestHandler())
+	child := l.With(Context{"a": 1})
+	if child.Enabled(INFO) || !child.Enabled(WARN) {
+		t.Errorf("Bad Enabled result for WARN handler")
+	}
+	l.SetHandlerLevel(id, DEBUG)
+	if !child.Enabled(DEBUG) {
+		t.Errorf("Bad Enabled result after SetHandlerLevel")
+	}
+	l.RemoveHandler(id)
+	if l.Enabled(FATAL) {
+		t.Errorf("Enabled after RemoveHandler")
+	}
+}
+
+// blockingHandler is a Handler whose Flush blocks until release is closed.
+// If entered is not nil, Flush sends to it before blocking.
+type blockingHandler struct {
+	release chan struct{}
+	entered chan struct{}
+}
+
+func (h *blockingHandler) Log(e Entry) {}
+
+func (h *blockingHandler) Flush() {
+	if h.entered != nil {
+		h.entered <- struct{}{}
+	}
+	<-h.release
+}
+
+func (h *blockingHandler) Name() string {
+	return "blocking"
+}
+
+func TestLogger_FlushContext(t *testing.T) {
+	var (
+		b      = &blockingHandler{release: make(chan struct{})}
+		config = Config{FlushTimeout: 10 * time.Millisecond}
+		l      = NewLogger(config, &countHandler{})
+		id     = l.Handle(DEBUG, b)
+	)
+	defer close(b.release)
+
+	err := l.Flush()
+	if !errors.Is(err, ErrFlushTimeout) {
+		t.Errorf("Bad error: %v", err)
+	}
+	flushErr, ok := err.(*FlushError)
+	if !ok {
+		t.Fatalf("Bad error type: %#v", err)
+	}
+	if len(flushErr.Pending) != 1 || flushErr.Pending[0] != (PendingHandler{id, "blocking"}) {
+		t.Errorf("Bad pending handlers: %v", flushErr.Pending)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = l.FlushContext(ctx)
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrFlushTimeout) {
+		t.Errorf("Bad error: %v", err)
+	}
+
+	l.RemoveHandler(id)
+	if err := l.FlushContext(context.Background()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
 // @TODO FIX
 //func TestLogger_Flush(t *testing.T) {
 //t.Skip("Broken, will fix later")
@@ -83,33 +259,74 @@ func TestLogger(t *testing.T) {
 //wg.Wait()
 //}
 
+// flushHandler is a *TestHandler that counts the calls to Flush.
+type flushHandler struct {
+	*TestHandler
+	flushes int
+}
+
+func (h *flushHandler) Flush() {
+	h.flushes++
+}
+
 func TestLogger_Panic(t *testing.T) {
 	var (
-		wg   sync.WaitGroup
-		w    = NewTestHandler()
-		l    = NewLogger(Config{FatalExit: false}, w)
-		file string
-		line int
+		wg        sync.WaitGroup
+		w         = &flushHandler{TestHandler: NewTestHandler()}
+		l         = NewLogger(DefaultConfig, w)
+		file      string
+		line      int
+		recovered interface{}
 	)
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		defer l.Panic()
-		_, file, line, _ = runtime.Caller(1)
-		panic("oh no")
+		defer func() { recovered = recover() }()
+		_, file, line, _ = runtime.Caller(0)
+		l.Panic("oh %s", "no")
 	}()
 	wg.Wait()
 
-	if !w.MatchLevel("panic: oh no", FATAL) {
+	if !w.MatchLevel("^oh no$", PANIC) {
 		t.Error("Panic was not logged.")
 	}
-	//e := w.Entries[0]
+	if err, ok := recovered.(error); !ok || err.Error() != "oh no" {
+		t.Errorf("Bad panic value: %#v", recovered)
+	}
+	if w.flushes != 1 {
+		t.Errorf("Bad #flushes: %d", w.flushes)
+	}
+	e := w.Entries[0]
+	if e.File() != file {
+		t.Errorf("Bad file: %s != %s", e.File(), file)
+	}
+	if e.Line() != line+1 {
+		t.Errorf("Bad line: %d != %d", e.Line(), line+1)
+	}
+}
+
+func TestLogger_Fatal(t *testing.T) {
+	var (
+		w      = &flushHandler{TestHandler: NewTestHandler()}
+		config = DefaultConfig
+		codes  []int
+	)
+	config.Exit = func(code int) {
+		if w.flushes != len(codes)+1 {
+			t.Errorf("Exit before flush")
+		}
+		codes = append(codes, code)
+	}
+	NewLogger(config, w).Fatal("Test %s", "A")
+
+	config.ExitCode = 3
+	NewLogger(config, w).With(Context{"b": 1}).Fatal("Test B")
 
-	//if e.File != file {
-		//t.Errorf("Bad file: %s != %s", e.File, file)
-	//}
-	//if e.Line != line {
-		//t.Errorf("Bad line: %d != %d", e.Line, line)
-	//}
+	if !w.MatchLevel("^Test A$", FATAL) || !w.MatchLevel("^Test B b=1$", FATAL) {
+		t.Error("Fatal was not logged.")
+	}
+	if len(codes) != 2 || codes[0] != 1 || codes[1] != 3 {
+		t.Errorf("Bad exit codes: %v", codes)
+	}
 }
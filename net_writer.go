@@ -0,0 +1,262 @@
+package log
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Framing determines how messages are delimited on stream connections.
+// Datagram networks (udp, unixgram) send every message as a single datagram
+// without framing.
+type Framing int
+
+const (
+	// FramingNewline terminates every message with a newline, unless it
+	// already ends with one.
+	FramingNewline Framing = iota
+	// FramingLength prefixes every message with its length as a 4 byte
+	// big-endian integer.
+	FramingLength
+	// FramingOctetCounting prefixes every message with its length in decimal
+	// followed by a space, as used for syslog over TCP (RFC 6587).
+	FramingOctetCounting
+)
+
+// NetWriterConfig configures a NetWriter.
+type NetWriterConfig struct {
+	// Network and Address are passed to net.Dial, e.g. "tcp" and
+	// "localhost:5170".
+	Network   string
+	Address   string
+	Formatter Formatter
+	Framing   Framing
+	// DialTimeout and WriteTimeout limit how long connecting and writing a
+	// single message may take. 0 means no limit.
+	DialTimeout  time.Duration
+	WriteTimeout time.Duration
+	// RetryInterval is the delay before reconnecting after connecting or
+	// writing failed. It is doubled after every failed attempt, up to
+	// MaxRetryInterval.
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+	ErrorHandler     ErrorHandler
+
+	// QueueConfig configures the queue holding the entries while the
+	// connection is slow or down.
+	QueueConfig
+}
+
+// NewNetWriter returns a *NetWriter for config, or an error if config is
+// invalid, see NetWriterConfig.Validate. A nil Formatter is replaced with the
+// one of DefaultNetWriterConfig. The connection is established by the
+// background goroutine, so failing to connect is reported to ErrorHandler.
+func NewNetWriter(config NetWriterConfig) (*NetWriter, error) {
+	if config.Formatter == nil {
+		config.Formatter = DefaultNetWriterConfig.Formatter
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	w := &NetWriter{config: config}
+	queue, err := newQueueFromConfig(config.QueueConfig, w, w.error)
+	if err != nil {
+		return nil, err
+	}
+	w.queue = queue
+	return w, nil
+}
+
+// NetWriter is a Handler that sends formatted entries to a network address,
+// e.g. a log collector. Entries are queued while the connection is slow or
+// being reestablished.
+type NetWriter struct {
+	config NetWriterConfig
+	queue  *queue
+	conn   net.Conn
+	// retryDelay is the current backoff delay. dropped counts the messages
+	// that were not sent because the writer was closed while disconnected,
+	// after which giveUp skips reconnecting.
+	retryDelay time.Duration
+	dropped    int
+	giveUp     bool
+	// connErr is the error of the last failed attempt to connect or write, or
+	// nil if the connection is healthy. It is guarded by errMu, see Err.
+	errMu   sync.Mutex
+	connErr error
+}
+
+// Validate returns an error describing the first invalid setting of c, or nil
+// if c is valid.
+func (c NetWriterConfig) Validate() error {
+	const config = "NetWriterConfig"
+	if c.Network == "" || c.Address == "" {
+		return invalidConfig(config, "Network and Address must be set")
+	} else if c.Formatter == nil {
+		return invalidConfig(config, "Formatter must be set")
+	} else if c.Framing < FramingNewline || c.Framing > FramingOctetCounting {
+		return invalidConfig(config, "Framing must be a valid Framing")
+	} else if c.RetryInterval <= 0 {
+		return invalidConfig(config, "RetryInterval must be positive")
+	}
+
+	err := validateNonNegative(config,
+		configSetting{"DialTimeout", int64(c.DialTimeout)},
+		configSetting{"WriteTimeout", int64(c.WriteTimeout)},
+		configSetting{"MaxRetryInterval", int64(c.MaxRetryInterval)},
+	)
+	if err == nil {
+		err = c.QueueConfig.validate(config)
+	}
+	if err == nil {
+		err = validateRetry(config, c.RetryInterval, c.MaxRetryInterval)
+	}
+	return err
+}
+
+func (w *NetWriter) Log(entry Entry) {
+	w.queue.push(w.config.Formatter.Format(entry), entry)
+}
+
+// Flush waits until all queued entries have been sent, which includes waiting
+// for the connection to be reestablished if it is down.
+func (w *NetWriter) Flush() {
+	w.queue.flush()
+}
+
+// Close sends all queued entries and closes the connection. Entries that can
+// not be sent because the connection is down are dropped and reported to the
+// ErrorHandler.
+func (w *NetWriter) Close() error {
+	return w.queue.close()
+}
+
+// Name returns the network and address written to.
+func (w *NetWriter) Name() string {
+	return fmt.Sprintf("NetWriter(%s://%s)", w.config.Network, w.config.Address)
+}
+
+// Err returns the error that caused the connection to fail, or nil if the
+// NetWriter is healthy.
+func (w *NetWriter) Err() error {
+	w.errMu.Lock()
+	defer w.errMu.Unlock()
+	return w.connErr
+}
+
+func (w *NetWriter) setConnErr(err error) {
+	w.errMu.Lock()
+	defer w.errMu.Unlock()
+	w.connErr = err
+}
+
+func (w *NetWriter) handleOp(op interface{}) {
+	if message, ok := op.(string); ok {
+		w.write(message)
+	}
+}
+
+func (w *NetWriter) handleFlush() {}
+
+func (w *NetWriter) handleClose() error {
+	if w.dropped > 0 {
+		w.error(fmt.Errorf("Dropped %d log entries because %s could not be reached.", w.dropped, w.Name()))
+	}
+	if w.conn != nil {
+		return w.conn.Close()
+	}
+	return nil
+}
+
+// write sends message, reconnecting until it succeeds or the writer is
+// closed. Messages that can never be sent, like datagrams that are too large,
+// are dropped and reported instead.
+func (w *NetWriter) write(message string) {
+	frame := w.frame(message)
+	for {
+		if w.giveUp {
+			w.dropped++
+			return
+		}
+		if w.conn == nil {
+			w.dial()
+		}
+		if w.conn != nil {
+			if w.config.WriteTimeout > 0 {
+				w.conn.SetWriteDeadline(time.Now().Add(w.config.WriteTimeout))
+			}
+			_, err := w.conn.Write(frame)
+			if err == nil {
+				w.retryDelay = 0
+				return
+			} else if w.datagram() && errors.Is(err, syscall.EMSGSIZE) {
+				w.error(fmt.Errorf("Dropped a log entry of %d bytes that %s could not send: %w", len(frame), w.Name(), err))
+				return
+			}
+			w.failed(err)
+			w.conn.Close()
+			w.conn = nil
+		}
+		if !w.queue.wait(w.retryDelay) {
+			w.giveUp = true
+		}
+	}
+}
+
+func (w *NetWriter) dial() {
+	conn, err := net.DialTimeout(w.config.Network, w.config.Address, w.config.DialTimeout)
+	if err != nil {
+		w.failed(err)
+		return
+	}
+	w.conn = conn
+	w.setConnErr(nil)
+}
+
+// failed reports err and updates the backoff delay.
+func (w *NetWriter) failed(err error) {
+	w.error(err)
+	w.setConnErr(err)
+	w.retryDelay = backoff(w.retryDelay, w.config.RetryInterval, w.config.MaxRetryInterval)
+}
+
+// frame returns message framed according to config.Framing.
+func (w *NetWriter) frame(message string) []byte {
+	switch {
+	case w.datagram():
+		return []byte(message)
+	case w.config.Framing == FramingLength:
+		frame := make([]byte, 4+len(message))
+		binary.BigEndian.PutUint32(frame, uint32(len(message)))
+		copy(frame[4:], message)
+		return frame
+	case w.config.Framing == FramingOctetCounting:
+		return []byte(strconv.Itoa(len(message)) + " " + message)
+	case strings.HasSuffix(message, "\n"):
+		return []byte(message)
+	default:
+		return []byte(message + "\n")
+	}
+}
+
+// datagram returns true if config.Network is message oriented.
+func (w *NetWriter) datagram() bool {
+	switch w.config.Network {
+	case "udp", "udp4", "udp6", "unixgram":
+		return true
+	}
+	return false
+}
+
+func (w *NetWriter) error(err error) {
+	if w.config.ErrorHandler != nil {
+		w.config.ErrorHandler(err)
+	}
+}
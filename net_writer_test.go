@@ -0,0 +1,226 @@
+package log
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNetWriter(t *testing.T) {
+	tests := []struct {
+		network string
+		framing Framing
+		// down closes the listener before logging. expected is the data read
+		// from the listener, with datagrams separated by "|".
+		down     bool
+		expected string
+		err      string
+	}{
+		{network: "tcp", framing: FramingNewline, expected: "A\nB b\n"},
+		{network: "tcp", framing: FramingLength, expected: "\x00\x00\x00\x02A\n\x00\x00\x00\x04B b\n"},
+		{network: "tcp", framing: FramingOctetCounting, expected: "2 A\n4 B b\n"},
+		{network: "udp", framing: FramingLength, expected: "A\n|B b\n"},
+		{network: "tcp", down: true, err: "Dropped 2 log entries because NetWriter(tcp://"},
+	}
+
+	for i, test := range tests {
+		var (
+			errs   = &errorRecorder{}
+			config = DefaultNetWriterConfig
+			read   func() (string, error)
+		)
+		config.Network, config.Framing = test.network, test.framing
+		config.Formatter = DefaultMessageFormatter
+		config.RetryInterval, config.MaxRetryInterval = time.Millisecond, 10*time.Millisecond
+		config.ErrorHandler = errs.Handle
+
+		if test.network == "udp" {
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			config.Address = conn.LocalAddr().String()
+			read = func() (string, error) {
+				var datagrams []string
+				buf := make([]byte, 64)
+				for len(datagrams) < strings.Count(test.expected, "|")+1 {
+					conn.SetReadDeadline(time.Now().Add(time.Second))
+					n, _, err := conn.ReadFrom(buf)
+					if err != nil {
+						return "", err
+					}
+					datagrams = append(datagrams, string(buf[:n]))
+				}
+				return strings.Join(datagrams, "|"), nil
+			}
+		} else {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+			config.Address = listener.Addr().String()
+			if test.down {
+				listener.Close()
+			}
+			read = func() (string, error) {
+				conn, err := listener.Accept()
+				if err != nil {
+					return "", err
+				}
+				defer conn.Close()
+				data, err := io.ReadAll(conn)
+				return string(data), err
+			}
+		}
+
+		w, err := NewNetWriter(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name := w.Name(); name != "NetWriter("+config.Network+"://"+config.Address+")" {
+			t.Errorf("test %d: Bad name: %s", i, name)
+		}
+		w.Log(NewEntry(INFO, "A"))
+		w.Log(NewEntry(INFO, "B b"))
+		if !test.down {
+			w.Flush()
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if !test.down {
+			if data, err := read(); err != nil {
+				t.Errorf("test %d: %s", i, err)
+			} else if data != test.expected {
+				t.Errorf("test %d: Bad data: %q != %q", i, data, test.expected)
+			}
+		}
+		errors := errs.Errors()
+		if test.err == "" && len(errors) != 0 {
+			t.Errorf("test %d: Unexpected errors: %v", i, errors)
+		} else if test.err != "" && (len(errors) == 0 || !strings.HasPrefix(errors[len(errors)-1].Error(), test.err)) {
+			t.Errorf("test %d: Bad errors: %v", i, errors)
+		}
+	}
+}
+
+func TestNetWriter_messageTooLong(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	errs := &errorRecorder{}
+	config := DefaultNetWriterConfig
+	config.Network, config.Address = "udp", conn.LocalAddr().String()
+	config.Formatter = DefaultMessageFormatter
+	config.ErrorHandler = errs.Handle
+	w, err := NewNetWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Log(NewEntry(INFO, strings.Repeat("A", 70000)))
+	w.Log(NewEntry(INFO, "B"))
+	w.Close()
+
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if n, _, err := conn.ReadFrom(buf); err != nil || string(buf[:n]) != "B\n" {
+		t.Errorf("Bad datagram: %q: %v", buf[:n], err)
+	}
+	errors := errs.Errors()
+	if len(errors) != 1 || !strings.HasPrefix(errors[0].Error(), "Dropped a log entry of 70001 bytes that NetWriter(udp://") {
+		t.Errorf("Bad errors: %v", errors)
+	}
+}
+
+func TestNetWriter_reconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	errs := &errorRecorder{}
+	config := DefaultNetWriterConfig
+	config.Network, config.Address, config.Framing = "tcp", address, FramingLength
+	config.Formatter = DefaultMessageFormatter
+	config.RetryInterval, config.MaxRetryInterval = time.Millisecond, 10*time.Millisecond
+	config.ErrorHandler = errs.Handle
+	w, err := NewNetWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Log(NewEntry(INFO, "A"))
+	for w.Err() == nil {
+		time.Sleep(time.Millisecond)
+	}
+
+	listener, err = net.Listen("tcp", address)
+	if err != nil {
+		t.Skipf("Could not listen on %s again: %s", address, err)
+	}
+	defer listener.Close()
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		t.Fatal(err)
+	}
+	message := make([]byte, binary.BigEndian.Uint32(header))
+	if _, err := io.ReadFull(r, message); err != nil {
+		t.Fatal(err)
+	}
+	if string(message) != "A\n" {
+		t.Errorf("Bad message: %q", message)
+	}
+	w.Flush()
+	if err := w.Err(); err != nil {
+		t.Errorf("Unhealthy after reconnect: %s", err)
+	}
+	if len(errs.Errors()) == 0 {
+		t.Errorf("Connection failure was not reported")
+	}
+	w.Close()
+}
+
+func TestNetWriterConfig_Validate(t *testing.T) {
+	tests := []struct {
+		modify func(c *NetWriterConfig)
+		err    string
+	}{
+		{func(c *NetWriterConfig) {}, ""},
+		{func(c *NetWriterConfig) { c.Address = "" }, "Network and Address must be set"},
+		{func(c *NetWriterConfig) { c.Framing = -1 }, "Framing must be a valid Framing"},
+		{func(c *NetWriterConfig) { c.RetryInterval = 0 }, "RetryInterval must be positive"},
+		{func(c *NetWriterConfig) { c.Capacity = -1 }, "Capacity must not be negative"},
+		{func(c *NetWriterConfig) { c.MaxRetryInterval = time.Millisecond }, "MaxRetryInterval must not be less than RetryInterval"},
+	}
+
+	for _, test := range tests {
+		config := DefaultNetWriterConfig
+		config.Network, config.Address = "tcp", "localhost:5170"
+		test.modify(&config)
+
+		err := config.Validate()
+		if test.err == "" && err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		} else if expected := "Invalid NetWriterConfig: " + test.err + "."; test.err != "" && (err == nil || err.Error() != expected) {
+			t.Errorf("Bad error: %v != %s", err, expected)
+		}
+	}
+}
@@ -0,0 +1,533 @@
+package log
+
+import (
+	"sync"
+	"time"
+)
+
+// OverflowPolicy determines what happens to entries logged while a queue is
+// full, see QueueConfig.
+type OverflowPolicy int
+
+const (
+	// OverflowDropNewest drops the entry being logged.
+	OverflowDropNewest OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest queued entry to make room.
+	OverflowDropOldest
+	// OverflowBlock blocks until there is room in the queue.
+	OverflowBlock
+	// OverflowBlockTimeout blocks until there is room in the queue, or drops
+	// the entry being logged after the configured timeout.
+	OverflowBlockTimeout
+	// OverflowDropByLevel drops the entry with the lowest level, either the
+	// one being logged or the oldest queued one with that level. Entries at
+	// the ERROR level and above are never dropped, logging them blocks
+	// instead if the queue contains no entries below ERROR.
+	OverflowDropByLevel
+)
+
+// QueueConfig configures the queue in which an AsyncHandler, FileWriter,
+// NetWriter or HTTPWriter holds entries until its background goroutine has
+// processed them.
+type QueueConfig struct {
+	// Capacity is the number of entries that can be queued.
+	Capacity int
+	// Blocking selects OverflowBlock if Overflow is OverflowDropNewest.
+	Blocking bool
+	// Overflow determines what happens to entries logged while the queue is
+	// full. Dropped entries are passed as *ErrEntryDropped to the
+	// ErrorHandler.
+	Overflow OverflowPolicy
+	// BlockTimeout is the timeout used by OverflowBlockTimeout.
+	BlockTimeout time.Duration
+	// DropReportInterval causes dropped entries to be reported as one
+	// *ErrEntriesDropped per interval instead of one *ErrEntryDropped each.
+	DropReportInterval time.Duration
+	// Spill stores entries that do not fit into the queue on disk instead of
+	// applying Overflow, see SpillConfig. AsyncHandler does not support it,
+	// as it queues entries rather than formatted messages.
+	Spill SpillConfig
+}
+
+// Validate returns an error describing the first invalid setting of c, or nil
+// if c is valid.
+func (c QueueConfig) Validate() error {
+	return c.validate("QueueConfig")
+}
+
+// validate is Validate for a QueueConfig embedded in the config type with the
+// given name.
+func (c QueueConfig) validate(config string) error {
+	err := validateNonNegative(config,
+		configSetting{"Capacity", int64(c.Capacity)},
+		configSetting{"BlockTimeout", int64(c.BlockTimeout)},
+		configSetting{"DropReportInterval", int64(c.DropReportInterval)},
+		configSetting{"Spill.SegmentSize", c.Spill.SegmentSize},
+		configSetting{"Spill.MaxBytes", c.Spill.MaxBytes},
+	)
+	if err != nil {
+		return err
+	} else if c.Overflow < OverflowDropNewest || c.Overflow > OverflowDropByLevel {
+		return invalidConfig(config, "Overflow must be a valid OverflowPolicy")
+	} else if c.Overflow == OverflowBlockTimeout && c.BlockTimeout == 0 {
+		return invalidConfig(config, "OverflowBlockTimeout requires BlockTimeout")
+	}
+	return nil
+}
+
+// newQueueFromConfig opens the spill configured by config, if any, and
+// returns a new queue for it, see newQueue. If the spill can not be opened, it
+// returns the error instead.
+func newQueueFromConfig(config QueueConfig, handler queueHandler, onError func(error)) (*queue, error) {
+	qc := queueConfig{
+		capacity:           config.Capacity,
+		overflow:           overflowPolicy(config.Overflow, config.Blocking),
+		blockTimeout:       config.BlockTimeout,
+		dropReportInterval: config.DropReportInterval,
+	}
+	if config.Spill.Dir != "" {
+		spill, err := openSpill(config.Spill, onError)
+		if err != nil {
+			return nil, err
+		}
+		qc.spill = spill
+	}
+	return newQueue(qc, handler, onError), nil
+}
+
+// queueConfig holds the settings of a queue.
+type queueConfig struct {
+	// capacity is the number of entries the queue can hold. It is treated as
+	// 1 if it is less than that.
+	capacity     int
+	overflow     OverflowPolicy
+	blockTimeout time.Duration
+	// dropReportInterval causes dropped entries to be reported as a single
+	// *ErrEntriesDropped per interval instead of one *ErrEntryDropped each.
+	dropReportInterval time.Duration
+	// spill receives the string ops of entries that do not fit into the
+	// queue, regardless of overflow. It is optional.
+	spill *spill
+}
+
+// overflowPolicy returns policy, or OverflowBlock for the default
+// OverflowDropNewest policy if blocking is set.
+func overflowPolicy(policy OverflowPolicy, blocking bool) OverflowPolicy {
+	if blocking && policy == OverflowDropNewest {
+		return OverflowBlock
+	}
+	return policy
+}
+
+// queue is a bounded FIFO of operations that are processed by a single
+// goroutine. It implements the overflow, flush and close semantics shared by
+// AsyncHandler, FileWriter, NetWriter and HTTPWriter.
+type queue struct {
+	config  queueConfig
+	handler queueHandler
+	onError func(error)
+
+	mu    sync.Mutex
+	items []queueItem
+	// entries is the number of entry items in items, dropped the number of
+	// entries dropped since the last drop report.
+	entries int
+	dropped int
+	// tail holds the ops added by send since the last entry was appended that
+	// have not been processed yet.
+	tail map[interface{}]bool
+	// ready has a value while items is not empty, space is closed and
+	// replaced when an entry is removed from a full queue.
+	ready chan struct{}
+	space chan struct{}
+
+	// closing is closed when close is called, closed is closed once loop has
+	// returned.
+	closing   chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+type queueItem struct {
+	op      interface{}
+	entry   Entry
+	isEntry bool
+}
+
+// queueHandler processes the operations of a queue. All methods are called
+// from the goroutine of the queue.
+type queueHandler interface {
+	// handleOp processes an operation passed to push or send.
+	handleOp(op interface{})
+	// handleFlush flushes all buffered data.
+	handleFlush()
+	// handleClose flushes all buffered data and releases all resources.
+	handleClose() error
+}
+
+type flushReq chan struct{}
+
+type closeReq chan error
+
+// newQueue returns a new queue and starts its goroutine. onError is called
+// for entries that are dropped or pushed after close.
+func newQueue(config queueConfig, handler queueHandler, onError func(error)) *queue {
+	if config.capacity < 1 {
+		config.capacity = 1
+	}
+	q := &queue{
+		config:  config,
+		handler: handler,
+		onError: onError,
+		tail:    map[interface{}]bool{},
+		ready:   make(chan struct{}, 1),
+		space:   make(chan struct{}),
+		closing: make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+	go q.loop()
+	if config.dropReportInterval > 0 {
+		go q.reportLoop()
+	}
+	return q
+}
+
+// push adds op for the given entry to the queue. If the queue is full, the
+// configured OverflowPolicy decides if push blocks or which entry is dropped.
+func (q *queue) push(op interface{}, entry Entry) {
+	item := queueItem{op: op, entry: entry, isEntry: true}
+	var timeout <-chan time.Time
+	for {
+		q.mu.Lock()
+		if q.isClosing() {
+			q.mu.Unlock()
+			q.onError(ErrClosed)
+			return
+		}
+		if message, ok := op.(string); ok && q.config.spill != nil {
+			// Once entries are spilled, all following entries need to be
+			// spilled as well until the spill is empty to keep them in order.
+			if q.entries >= q.config.capacity || !q.config.spill.empty() {
+				err := q.config.spill.write(message)
+				if err == nil {
+					q.signalReady()
+					q.mu.Unlock()
+					return
+				}
+				dropErr := q.drop(entry)
+				q.mu.Unlock()
+				if err != ErrSpillFull {
+					q.report(err)
+				}
+				q.report(dropErr)
+				return
+			}
+		}
+		if q.entries < q.config.capacity {
+			q.append(item)
+			q.mu.Unlock()
+			return
+		}
+
+		block := false
+		switch q.config.overflow {
+		case OverflowDropOldest:
+			if i := q.oldestEntry(); i >= 0 {
+				err := q.dropAt(i)
+				q.append(item)
+				q.mu.Unlock()
+				q.report(err)
+				return
+			}
+			block = true
+		case OverflowBlock:
+			block = true
+		case OverflowBlockTimeout:
+			if timeout == nil {
+				timer := time.NewTimer(q.config.blockTimeout)
+				defer timer.Stop()
+				timeout = timer.C
+			}
+			block = true
+		case OverflowDropByLevel:
+			i := q.lowestEntry()
+			if i >= 0 && entry.Level > q.items[i].entry.Level && q.items[i].entry.Level < ERROR {
+				err := q.dropAt(i)
+				q.append(item)
+				q.mu.Unlock()
+				q.report(err)
+				return
+			}
+			block = entry.Level >= ERROR
+		}
+
+		if !block {
+			err := q.drop(entry)
+			q.mu.Unlock()
+			q.report(err)
+			return
+		}
+		space := q.space
+		q.mu.Unlock()
+
+		select {
+		case <-space:
+		case <-timeout:
+			q.mu.Lock()
+			err := q.drop(entry)
+			q.mu.Unlock()
+			q.report(err)
+			return
+		case <-q.closing:
+			q.onError(ErrClosed)
+			return
+		}
+	}
+}
+
+// send adds op to the queue regardless of its capacity, unless an equal op
+// was added after the last entry and is still queued. Ops sent periodically,
+// e.g. watchReq, therefore do not pile up while the handler is stuck, and are
+// still processed after all entries queued before them. It returns false if
+// the queue is closing.
+func (q *queue) send(op interface{}) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.isClosing() {
+		return false
+	}
+	if !q.tail[op] {
+		q.tail[op] = true
+		q.append(queueItem{op: op})
+	}
+	return true
+}
+
+// isClosing returns true if close was called. The caller must hold mu, which
+// guarantees that ops added before close are processed before the handler is
+// closed.
+func (q *queue) isClosing() bool {
+	select {
+	case <-q.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// wait sleeps for d, e.g. before retrying a failed operation. It returns
+// false as soon as the queue is closing.
+func (q *queue) wait(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-q.closing:
+		return false
+	}
+}
+
+// flush waits until all operations queued before it have been processed and
+// the handler has been flushed.
+func (q *queue) flush() {
+	req := make(flushReq)
+	if !q.send(req) {
+		return
+	}
+	select {
+	case <-req:
+	case <-q.closed:
+	}
+}
+
+// close processes all queued operations, closes the handler and stops the
+// goroutines of the queue. It returns ErrClosed if it was called before.
+func (q *queue) close() error {
+	err := ErrClosed
+	q.closeOnce.Do(func() {
+		req := make(closeReq)
+		q.mu.Lock()
+		close(q.closing)
+		q.append(queueItem{op: req})
+		q.mu.Unlock()
+		err = <-req
+	})
+	return err
+}
+
+func (q *queue) loop() {
+	for {
+		switch t := q.pop().(type) {
+		case flushReq:
+			q.drainSpill()
+			q.handler.handleFlush()
+			t <- struct{}{}
+		case closeReq:
+			q.drainSpill()
+			err := q.handler.handleClose()
+			if q.config.spill != nil {
+				q.report(q.config.spill.close())
+			}
+			close(q.closed)
+			t <- err
+			return
+		default:
+			if _, ok := t.(string); !ok {
+				// Spilled entries were pushed before the control op.
+				q.drainSpill()
+			}
+			q.handler.handleOp(t)
+		}
+	}
+}
+
+// drainSpill passes all spilled entries to the handler.
+func (q *queue) drainSpill() {
+	if q.config.spill == nil {
+		return
+	}
+	for {
+		message, ok := q.config.spill.read()
+		if !ok {
+			return
+		}
+		q.handler.handleOp(message)
+	}
+}
+
+// pop removes the first item from the queue and returns its op, waiting for
+// one if the queue is empty. Spilled entries are returned once the queue is
+// empty, as they were all added after the entries in the queue.
+func (q *queue) pop() interface{} {
+	for {
+		q.mu.Lock()
+		if len(q.items) > 0 {
+			item := q.items[0]
+			q.items[0] = queueItem{}
+			q.items = q.items[1:]
+			if item.isEntry {
+				q.removedEntry()
+			} else {
+				delete(q.tail, item.op)
+			}
+			if len(q.items) > 0 {
+				q.signalReady()
+			}
+			q.mu.Unlock()
+			return item.op
+		}
+		q.mu.Unlock()
+		if q.config.spill != nil {
+			if message, ok := q.config.spill.read(); ok {
+				return message
+			}
+		}
+		<-q.ready
+	}
+}
+
+// append adds item to the end of the queue. The caller must hold mu.
+func (q *queue) append(item queueItem) {
+	q.items = append(q.items, item)
+	if item.isEntry {
+		q.entries++
+		if len(q.tail) > 0 {
+			q.tail = map[interface{}]bool{}
+		}
+	}
+	q.signalReady()
+}
+
+func (q *queue) signalReady() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// removedEntry updates entries after an entry was removed and wakes up
+// blocked calls to push if the queue was full. The caller must hold mu.
+func (q *queue) removedEntry() {
+	if q.entries == q.config.capacity {
+		close(q.space)
+		q.space = make(chan struct{})
+	}
+	q.entries--
+}
+
+// dropAt removes the entry at index i and drops it, see drop. The caller must
+// hold mu.
+func (q *queue) dropAt(i int) error {
+	entry := q.items[i].entry
+	q.items = append(q.items[:i], q.items[i+1:]...)
+	q.removedEntry()
+	return q.drop(entry)
+}
+
+// drop returns the error to report for dropping entry, or counts it and
+// returns nil if drops are reported periodically. The caller must hold mu and
+// report the error after releasing it.
+func (q *queue) drop(entry Entry) error {
+	if q.config.dropReportInterval > 0 {
+		q.dropped++
+		return nil
+	}
+	return &ErrEntryDropped{entry}
+}
+
+// report passes err to onError unless it is nil.
+func (q *queue) report(err error) {
+	if err != nil {
+		q.onError(err)
+	}
+}
+
+// oldestEntry returns the index of the oldest entry item, or -1. The caller
+// must hold mu.
+func (q *queue) oldestEntry() int {
+	for i, item := range q.items {
+		if item.isEntry {
+			return i
+		}
+	}
+	return -1
+}
+
+// lowestEntry returns the index of the oldest entry item with the lowest
+// level, or -1. The caller must hold mu.
+func (q *queue) lowestEntry() int {
+	lowest := -1
+	for i, item := range q.items {
+		if item.isEntry && (lowest < 0 || item.entry.Level < q.items[lowest].entry.Level) {
+			lowest = i
+		}
+	}
+	return lowest
+}
+
+// reportLoop reports the entries dropped during every dropReportInterval
+// until the queue is closed.
+func (q *queue) reportLoop() {
+	ticker := time.NewTicker(q.config.dropReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			q.reportDropped()
+		case <-q.closed:
+			q.reportDropped()
+			return
+		}
+	}
+}
+
+func (q *queue) reportDropped() {
+	q.mu.Lock()
+	dropped := q.dropped
+	q.dropped = 0
+	q.mu.Unlock()
+	if dropped > 0 {
+		q.onError(&ErrEntriesDropped{Count: dropped, Interval: q.config.dropReportInterval})
+	}
+}
@@ -0,0 +1,81 @@
+package log
+
+import (
+	"testing"
+)
+
+// opRecorder is a queueHandler that records its ops. handleOp blocks until
+// release is closed.
+type opRecorder struct {
+	release chan struct{}
+	entered chan struct{}
+	ops     []interface{}
+}
+
+func (h *opRecorder) handleOp(op interface{}) {
+	h.entered <- struct{}{}
+	<-h.release
+	h.ops = append(h.ops, op)
+}
+
+func (h *opRecorder) handleFlush() {}
+
+func (h *opRecorder) handleClose() error { return nil }
+
+func TestQueue_send(t *testing.T) {
+	h := &opRecorder{release: make(chan struct{}), entered: make(chan struct{}, 10)}
+	q := newQueue(queueConfig{capacity: 2}, h, func(error) {})
+	q.push("a", NewEntry(INFO, "a"))
+	<-h.entered
+
+	// Equal ops sent while the handler is stuck are merged, unless an entry
+	// was queued in between.
+	for i := 0; i < 100; i++ {
+		q.send(watchReq{})
+	}
+	q.push("b", NewEntry(INFO, "b"))
+	for i := 0; i < 100; i++ {
+		q.send(watchReq{})
+		q.send(rotateReq{})
+	}
+	q.mu.Lock()
+	items := len(q.items)
+	q.mu.Unlock()
+	if items != 4 {
+		t.Errorf("Bad #items: %d", items)
+	}
+
+	close(h.release)
+	q.close()
+	expected := []interface{}{"a", watchReq{}, "b", watchReq{}, rotateReq{}}
+	if len(h.ops) != len(expected) {
+		t.Fatalf("Bad ops: %v", h.ops)
+	}
+	for i, op := range h.ops {
+		if op != expected[i] {
+			t.Errorf("Bad op %d: %v != %v", i, op, expected[i])
+		}
+	}
+}
+
+func TestQueueConfig_Validate(t *testing.T) {
+	tests := []struct {
+		config QueueConfig
+		err    string
+	}{
+		{QueueConfig{Capacity: 1}, ""},
+		{QueueConfig{Capacity: -1}, "Capacity must not be negative"},
+		{QueueConfig{Spill: SpillConfig{MaxBytes: -1}}, "Spill.MaxBytes must not be negative"},
+		{QueueConfig{Overflow: OverflowDropByLevel + 1}, "Overflow must be a valid OverflowPolicy"},
+		{QueueConfig{Overflow: OverflowBlockTimeout}, "OverflowBlockTimeout requires BlockTimeout"},
+	}
+
+	for i, test := range tests {
+		err := test.config.Validate()
+		if test.err == "" && err != nil {
+			t.Errorf("test %d: Unexpected error: %s", i, err)
+		} else if expected := "Invalid QueueConfig: " + test.err + "."; test.err != "" && (err == nil || err.Error() != expected) {
+			t.Errorf("test %d: Bad error: %v != %s", i, err, expected)
+		}
+	}
+}
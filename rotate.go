@@ -0,0 +1,197 @@
+package log
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupLayout is the time layout used for the suffix of rotated files, e.g.
+// "app.log.2014-01-02T03-04-05.678000000".
+const backupLayout = "2006-01-02T15-04-05.000000000"
+
+// needsRotation returns true if writing n more bytes to the file requires it
+// to be rotated according to config.MaxSize or config.RotateInterval.
+func (w *FileWriter) needsRotation(n int) bool {
+	if w.file == nil {
+		return false
+	}
+	if w.config.MaxSize > 0 && w.size > 0 && w.size+int64(n) > w.config.MaxSize {
+		return true
+	}
+	return w.config.RotateInterval > 0 && !w.now().Before(w.nextRotation)
+}
+
+// rotateBackup renames the current file to a timestamped backup, opens a new
+// file at config.Path and removes old backups.
+func (w *FileWriter) rotateBackup() {
+	w.closeFile()
+	if err := w.file.Close(); err != nil {
+		w.error(err)
+	}
+
+	t := w.now().UTC()
+	backup := w.config.Path + "." + t.Format(backupLayout)
+	for {
+		if _, err := os.Lstat(backup); os.IsNotExist(err) {
+			break
+		}
+		t = t.Add(time.Nanosecond)
+		backup = w.config.Path + "." + t.Format(backupLayout)
+	}
+	if err := os.Rename(w.config.Path, backup); err != nil {
+		w.error(err)
+	}
+
+	w.open()
+	w.pruneBackups()
+	if w.compressCh != nil {
+		select {
+		case w.compressCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// backupFile is a rotated file along with the time it was rotated at.
+type backupFile struct {
+	path       string
+	time       time.Time
+	compressed bool
+}
+
+// backups returns the rotated files of config.Path, newest first.
+func (w *FileWriter) backups() ([]backupFile, error) {
+	dir, base := filepath.Split(w.config.Path)
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []backupFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, base+".") {
+			continue
+		}
+		suffix := strings.TrimSuffix(name[len(base)+1:], ".gz")
+		t, err := time.Parse(backupLayout, suffix)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backupFile{
+			path:       filepath.Join(dir, name),
+			time:       t,
+			compressed: strings.HasSuffix(name, ".gz"),
+		})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].time.After(backups[j].time)
+	})
+	return backups, nil
+}
+
+// pruneBackups removes the backups exceeding config.MaxBackups or
+// config.MaxAge.
+func (w *FileWriter) pruneBackups() {
+	if w.config.MaxBackups <= 0 && w.config.MaxAge <= 0 {
+		return
+	}
+	backups, err := w.backups()
+	if err != nil {
+		w.error(err)
+		return
+	}
+
+	cutoff := w.now().Add(-w.config.MaxAge)
+	for i, backup := range backups {
+		tooMany := w.config.MaxBackups > 0 && i >= w.config.MaxBackups
+		tooOld := w.config.MaxAge > 0 && backup.time.Before(cutoff)
+		if tooMany || tooOld {
+			if err := os.Remove(backup.path); err != nil {
+				w.error(err)
+			}
+		}
+	}
+}
+
+// compressLoop compresses backups whenever it is triggered via compressCh,
+// until the queue has been closed.
+func (w *FileWriter) compressLoop() {
+	defer close(w.compressDone)
+	for {
+		select {
+		case <-w.compressCh:
+			w.compressBackups()
+		case <-w.queue.closed:
+			select {
+			case <-w.compressCh:
+				w.compressBackups()
+			default:
+			}
+			return
+		}
+	}
+}
+
+// compressBackups compresses all uncompressed backups except for the
+// config.CompressDelay most recent ones.
+func (w *FileWriter) compressBackups() {
+	backups, err := w.backups()
+	if err != nil {
+		w.error(err)
+		return
+	}
+	for i, backup := range backups {
+		if i < w.config.CompressDelay || backup.compressed {
+			continue
+		}
+		if err := compressFile(backup.path, w.config.Perm); err != nil && !os.IsNotExist(err) {
+			w.error(err)
+		}
+	}
+}
+
+// compressFile writes a gzip compressed copy of path to path+".gz.tmp",
+// renames it to path+".gz" and removes path.
+func compressFile(path string, perm os.FileMode) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(path)
+}
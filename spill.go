@@ -0,0 +1,258 @@
+package log
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrSpillFull = errors.New("Spill directory is full.")
+)
+
+// SpillConfig configures a disk queue that stores formatted entries which do
+// not fit into the in-memory queue of a FileWriter, and replays them in order
+// once the writer catches up. Spilled entries survive process restarts, but
+// entries of a partially replayed segment may be written twice after a crash.
+type SpillConfig struct {
+	// Dir is the directory the segment files are stored in. Spilling is
+	// disabled if it is empty.
+	Dir string
+	// SegmentSize is the size after which a new segment file is started.
+	// 1 MB is used if it is 0.
+	SegmentSize int64
+	// MaxBytes limits the total size of all segment files. Entries that do not
+	// fit are dropped. 0 means no limit.
+	MaxBytes int64
+}
+
+const (
+	defaultSegmentSize = 1 << 20
+	spillSuffix        = ".seg"
+	// spillHeaderSize is the size of the length and CRC-32 checksum stored in
+	// front of every record.
+	spillHeaderSize = 8
+)
+
+// spill is the disk queue configured by a SpillConfig. write and read may be
+// called concurrently.
+type spill struct {
+	config  SpillConfig
+	onError func(error)
+
+	mu       sync.Mutex
+	segments []*spillSegment
+	// writer is the file of the last segment if it was created by this spill,
+	// reader the file of the first segment, and offset the position of the
+	// next record within it.
+	writer *os.File
+	reader *os.File
+	offset int64
+	size   int64
+}
+
+type spillSegment struct {
+	id   uint64
+	size int64
+}
+
+// openSpill opens the spill directory, creating it if needed. Segments left
+// by a previous process are replayed before new entries.
+func openSpill(config SpillConfig, onError func(error)) (*spill, error) {
+	if config.SegmentSize == 0 {
+		config.SegmentSize = defaultSegmentSize
+	}
+	if err := os.MkdirAll(config.Dir, 0700); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(config.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &spill{config: config, onError: onError}
+	for _, entry := range entries {
+		id, err := strconv.ParseUint(strings.TrimSuffix(entry.Name(), spillSuffix), 10, 64)
+		if err != nil || !strings.HasSuffix(entry.Name(), spillSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		s.segments = append(s.segments, &spillSegment{id: id, size: info.Size()})
+		s.size += info.Size()
+	}
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].id < s.segments[j].id
+	})
+	return s, nil
+}
+
+func (s *spill) path(seg *spillSegment) string {
+	return filepath.Join(s.config.Dir, fmt.Sprintf("%020d%s", seg.id, spillSuffix))
+}
+
+// empty returns true if there are no records left to read.
+func (s *spill) empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.segments) == 0 || len(s.segments) == 1 && s.offset >= s.segments[0].size
+}
+
+// write appends message as a new record. Records are only appended to
+// segments created by this spill, so records following a torn write of a
+// crashed process are not lost. For the same reason, a failed write closes
+// the current segment, so the next record starts a new one.
+func (s *spill) write(message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recordSize := int64(spillHeaderSize + len(message))
+	if s.config.MaxBytes > 0 && s.size+recordSize > s.config.MaxBytes {
+		return ErrSpillFull
+	}
+
+	last := len(s.segments) - 1
+	if s.writer == nil || s.segments[last].size > 0 && s.segments[last].size+recordSize > s.config.SegmentSize {
+		seg := &spillSegment{id: 1}
+		if last >= 0 {
+			seg.id = s.segments[last].id + 1
+		}
+		file, err := os.OpenFile(s.path(seg), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		if s.writer != nil {
+			s.writer.Close()
+		}
+		s.writer = file
+		s.segments = append(s.segments, seg)
+		last++
+	}
+
+	record := make([]byte, recordSize)
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(message)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE([]byte(message)))
+	copy(record[spillHeaderSize:], message)
+	n, err := s.writer.Write(record)
+	s.segments[last].size += int64(n)
+	s.size += int64(n)
+	if err != nil {
+		s.writer.Close()
+		s.writer = nil
+	}
+	return err
+}
+
+// read returns the oldest record and removes it, or returns false if there
+// are no records. Corrupt records cause the rest of their segment to be
+// skipped and reported as an error.
+func (s *spill) read() (string, bool) {
+	var errs []error
+	defer func() {
+		for _, err := range errs {
+			s.onError(err)
+		}
+	}()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.segments) > 0 {
+		seg := s.segments[0]
+		if s.offset >= seg.size {
+			if len(s.segments) == 1 && s.writer != nil {
+				// Keep appending to the current segment.
+				return "", false
+			}
+			if err := s.removeFirst(); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		message, err := s.readRecord(seg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Skipping %d bytes of spill segment %s at offset %d: %s.", seg.size-s.offset, s.path(seg), s.offset, err))
+			s.offset = seg.size
+			continue
+		}
+		return message, true
+	}
+	return "", false
+}
+
+// readRecord reads the record at s.offset of seg, which must be the first
+// segment.
+func (s *spill) readRecord(seg *spillSegment) (string, error) {
+	if s.reader == nil {
+		file, err := os.Open(s.path(seg))
+		if err != nil {
+			return "", err
+		}
+		s.reader = file
+	}
+
+	header := make([]byte, spillHeaderSize)
+	if _, err := s.reader.ReadAt(header, s.offset); err != nil {
+		return "", err
+	}
+	length := int64(binary.BigEndian.Uint32(header[0:4]))
+	if s.offset+spillHeaderSize+length > seg.size {
+		return "", io.ErrUnexpectedEOF
+	}
+	message := make([]byte, length)
+	if _, err := s.reader.ReadAt(message, s.offset+spillHeaderSize); err != nil {
+		return "", err
+	}
+	if crc32.ChecksumIEEE(message) != binary.BigEndian.Uint32(header[4:8]) {
+		return "", errors.New("checksum mismatch")
+	}
+	s.offset += spillHeaderSize + length
+	return string(message), nil
+}
+
+// removeFirst deletes the first segment. The caller must hold mu.
+func (s *spill) removeFirst() error {
+	seg := s.segments[0]
+	if s.reader != nil {
+		s.reader.Close()
+		s.reader = nil
+	}
+	if len(s.segments) == 1 && s.writer != nil {
+		s.writer.Close()
+		s.writer = nil
+	}
+	s.segments = s.segments[1:]
+	s.size -= seg.size
+	s.offset = 0
+	return os.Remove(s.path(seg))
+}
+
+// close closes all open files. Fully read segments are deleted, all others
+// are kept for the next openSpill.
+func (s *spill) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	if len(s.segments) == 1 && s.offset >= s.segments[0].size {
+		err = s.removeFirst()
+	}
+	if s.reader != nil {
+		s.reader.Close()
+		s.reader = nil
+	}
+	if s.writer != nil {
+		s.writer.Close()
+		s.writer = nil
+	}
+	return err
+}
@@ -0,0 +1,108 @@
+package log
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSpill(t *testing.T) {
+	var (
+		dir    = t.TempDir()
+		errs   = &errorRecorder{}
+		config = SpillConfig{Dir: dir, MaxBytes: 30}
+	)
+
+	// Every spill starts a new segment, so A and B/X end up in two segments
+	// left behind for the next process.
+	for _, messages := range [][]string{{"A\n"}, {"B\n", "X\n"}} {
+		s, err := openSpill(config, errs.Handle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, message := range messages {
+			if err := s.write(message); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(messages) == 2 {
+			if err := s.write("Z\n"); err != ErrSpillFull {
+				t.Errorf("Bad error: %v", err)
+			}
+		}
+		s.close()
+	}
+
+	// Corrupt the payload of X.
+	segment := filepath.Join(dir, "00000000000000000002.seg")
+	data, err := os.ReadFile(segment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] = 'Y'
+	if err := os.WriteFile(segment, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	fileConfig := DefaultFileWriterConfig
+	fileConfig.Writer = out
+	fileConfig.BufSize = 0
+	fileConfig.FlushInterval = 0
+	fileConfig.Formatter = DefaultMessageFormatter
+	fileConfig.ErrorHandler = errs.Handle
+	fileConfig.Spill = SpillConfig{Dir: dir}
+	w := NewFileWriterConfig(fileConfig)
+	w.Log(NewEntry(INFO, "C"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.String() != "A\nB\nC\n" {
+		t.Errorf("Bad data: %q", out)
+	}
+	if errors := errs.Errors(); len(errors) != 1 || !strings.HasPrefix(errors[0].Error(), "Skipping 10 bytes of spill segment") {
+		t.Errorf("Bad errors: %v", errors)
+	}
+	if segments, _ := filepath.Glob(filepath.Join(dir, "*.seg")); len(segments) != 0 {
+		t.Errorf("Segments left: %v", segments)
+	}
+}
+
+func TestSpill_writeError(t *testing.T) {
+	errs := &errorRecorder{}
+	s, err := openSpill(SpillConfig{Dir: t.TempDir()}, errs.Handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	if err := s.write("A\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace the segment file with a read-only one to make writes fail.
+	s.writer.Close()
+	if s.writer, err = os.Open(s.path(s.segments[0])); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.write("B\n"); err == nil {
+		t.Fatal("Expected error")
+	}
+	if err := s.write("C\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	var messages []string
+	for {
+		message, ok := s.read()
+		if !ok {
+			break
+		}
+		messages = append(messages, message)
+	}
+	if strings.Join(messages, "") != "A\nC\n" || len(errs.Errors()) != 0 {
+		t.Errorf("Bad messages: %q, errors: %v", messages, errs.Errors())
+	}
+}
@@ -0,0 +1,253 @@
+package log
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SyslogProtocol selects the message format of a SyslogFormatter.
+type SyslogProtocol int
+
+const (
+	// RFC5424 is the current syslog protocol, which supports structured data.
+	RFC5424 SyslogProtocol = iota
+	// RFC3164 is the legacy BSD syslog protocol.
+	RFC3164
+)
+
+// SyslogFacility is the facility part of the PRI value of a syslog message.
+type SyslogFacility int
+
+const (
+	SyslogUser   SyslogFacility = 1
+	SyslogDaemon SyslogFacility = 3
+	SyslogAuth   SyslogFacility = 4
+	SyslogLocal0 SyslogFacility = 16
+	SyslogLocal1 SyslogFacility = 17
+	SyslogLocal2 SyslogFacility = 18
+	SyslogLocal3 SyslogFacility = 19
+	SyslogLocal4 SyslogFacility = 20
+	SyslogLocal5 SyslogFacility = 21
+	SyslogLocal6 SyslogFacility = 22
+	SyslogLocal7 SyslogFacility = 23
+)
+
+// syslogSeverities maps levels to syslog severities, see syslogSeverity.
+var syslogSeverities = map[Level]int{
+	DEBUG: 7, // Debug
+	INFO:  6, // Informational
+	WARN:  4, // Warning
+	ERROR: 3, // Error
+	PANIC: 2, // Critical
+	FATAL: 1, // Alert
+}
+
+// syslogSeverity returns the syslog severity of lvl. Levels below DEBUG are
+// treated as DEBUG and levels above FATAL as FATAL, so an unknown level never
+// results in 0 (Emergency).
+func syslogSeverity(lvl Level) int {
+	if lvl < DEBUG {
+		lvl = DEBUG
+	} else if lvl > FATAL {
+		lvl = FATAL
+	}
+	return syslogSeverities[lvl]
+}
+
+// syslogSockets are the paths of the local syslog socket on common systems.
+var syslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// NewSyslogFormatter returns a *SyslogFormatter for the given protocol that
+// uses the user facility, the hostname, the name of the executable as app
+// name and the process id.
+func NewSyslogFormatter(protocol SyslogProtocol) *SyslogFormatter {
+	hostname, _ := os.Hostname()
+	return &SyslogFormatter{
+		Protocol: protocol,
+		Facility: SyslogUser,
+		Hostname: hostname,
+		AppName:  filepath.Base(os.Args[0]),
+		ProcID:   strconv.Itoa(os.Getpid()),
+	}
+}
+
+// SyslogFormatter formats entries as syslog messages for a NetWriter, see
+// NewSyslogWriter. The severity is derived from the level of the entry.
+//
+// With RFC5424, Fields are rendered as structured data, e.g.
+//
+//	<14>1 2014-01-02T03:04:05.678000Z host app 123 - [fields@32473 user_id="5"] User login
+//
+// With RFC3164, they are appended to the message as logfmt pairs, e.g.
+//
+//	<14>Jan  2 03:04:05 host app[123]: User login user_id=5
+//
+// Messages are not terminated by a newline, as framing is left to the
+// NetWriter.
+type SyslogFormatter struct {
+	Protocol SyslogProtocol
+	Facility SyslogFacility
+	// Hostname, AppName and ProcID identify the sender. Hostname is omitted
+	// from RFC3164 messages if it is empty, as expected by most local syslog
+	// daemons.
+	Hostname string
+	AppName  string
+	ProcID   string
+	// MsgID is the RFC5424 MSGID of all messages. If MsgIDField is set, the
+	// value of the field with that key is used instead if present.
+	MsgID      string
+	MsgIDField string
+	// SDID is the RFC5424 SD-ID of the structured data element holding the
+	// fields. "fields@32473" is used if it is empty.
+	SDID string
+}
+
+// DefaultSDID is the SD-ID used by SyslogFormatter if SDID is empty. 32473 is
+// the private enterprise number reserved for documentation (RFC 5612).
+const DefaultSDID = "fields@32473"
+
+func (f *SyslogFormatter) Format(e Entry) string {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('<')
+	buf.WriteString(strconv.Itoa(int(f.Facility)*8 + syslogSeverity(e.Level)))
+	buf.WriteByte('>')
+	if f.Protocol == RFC3164 {
+		f.format3164(buf, e)
+	} else {
+		f.format5424(buf, e)
+	}
+	return buf.String()
+}
+
+func (f *SyslogFormatter) format5424(buf *bytes.Buffer, e Entry) {
+	msgID, fields := f.MsgID, e.Fields
+	if f.MsgIDField != "" {
+		if val, ok := e.Fields.Get(f.MsgIDField); ok {
+			msgID = fieldString(val)
+			fields = make(Fields, 0, len(e.Fields)-1)
+			for _, field := range e.Fields {
+				if field.Key != f.MsgIDField {
+					fields = append(fields, field)
+				}
+			}
+		}
+	}
+
+	buf.WriteString("1 ")
+	buf.WriteString(e.Time.Format("2006-01-02T15:04:05.000000Z07:00"))
+	for _, field := range []struct {
+		val    string
+		maxLen int
+	}{
+		{f.Hostname, 255},
+		{f.AppName, 48},
+		{f.ProcID, 128},
+		{msgID, 32},
+	} {
+		buf.WriteByte(' ')
+		buf.WriteString(syslogHeaderField(field.val, field.maxLen))
+	}
+
+	buf.WriteByte(' ')
+	if len(fields) == 0 {
+		buf.WriteByte('-')
+	} else {
+		sdID := f.SDID
+		if sdID == "" {
+			sdID = DefaultSDID
+		}
+		buf.WriteByte('[')
+		buf.WriteString(sdID)
+		for _, field := range fields {
+			buf.WriteByte(' ')
+			buf.WriteString(syslogParamName(field.Key))
+			buf.WriteString(`="`)
+			buf.WriteString(syslogParamValue.Replace(fieldString(field.Value)))
+			buf.WriteByte('"')
+		}
+		buf.WriteByte(']')
+	}
+
+	if e.Message != "" {
+		buf.WriteByte(' ')
+		buf.WriteString(e.Message)
+	}
+}
+
+func (f *SyslogFormatter) format3164(buf *bytes.Buffer, e Entry) {
+	buf.WriteString(e.Time.Format("Jan _2 15:04:05"))
+	if f.Hostname != "" {
+		buf.WriteByte(' ')
+		buf.WriteString(syslogHeaderField(f.Hostname, 255))
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(syslogHeaderField(f.AppName, 32))
+	if f.ProcID != "" {
+		buf.WriteByte('[')
+		buf.WriteString(f.ProcID)
+		buf.WriteByte(']')
+	}
+	buf.WriteString(": ")
+	buf.WriteString(e.Message)
+	for _, field := range e.Fields {
+		buf.WriteByte(' ')
+		writeLogfmtPair(buf, logfmtKey(field.Key), field.Value)
+	}
+}
+
+// syslogHeaderField returns val truncated to maxLen and with all characters
+// but printable ASCII replaced by '_', or "-" if val is empty.
+func syslogHeaderField(val string, maxLen int) string {
+	if val == "" {
+		return "-"
+	}
+	val = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, val)
+	if len(val) > maxLen {
+		val = val[:maxLen]
+	}
+	return val
+}
+
+// syslogParamName returns key as a valid RFC5424 PARAM-NAME.
+func syslogParamName(key string) string {
+	key = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, key)
+	return syslogHeaderField(key, 32)
+}
+
+// syslogParamValue escapes the characters that must be escaped in RFC5424
+// PARAM-VALUEs.
+var syslogParamValue = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// NewSyslogWriter returns a *NetWriter for config that defaults to the local
+// syslog socket if Network and Address are empty, and to a SyslogFormatter
+// using RFC5424 if Formatter is nil. config is usually
+// DefaultSyslogWriterConfig. Note that DefaultNetWriterConfig formats entries
+// as JSON, which syslog daemons do not understand.
+func NewSyslogWriter(config NetWriterConfig) (*NetWriter, error) {
+	if config.Network == "" && config.Address == "" {
+		config.Network, config.Address = "unixgram", syslogSockets[0]
+		for _, path := range syslogSockets {
+			if _, err := os.Stat(path); err == nil {
+				config.Address = path
+				break
+			}
+		}
+	}
+	if config.Formatter == nil {
+		config.Formatter = NewSyslogFormatter(RFC5424)
+	}
+	return NewNetWriter(config)
+}
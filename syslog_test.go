@@ -0,0 +1,92 @@
+package log
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogFormatter(t *testing.T) {
+	e := Entry{
+		Time:    time.Date(2014, 1, 2, 3, 4, 5, 678901234, time.UTC),
+		Level:   ERROR,
+		Message: "Login failed",
+		Fields: Fields{
+			{"user id", 5},
+			{"event", "login"},
+			{"reason", `bad "password"]`},
+		},
+	}
+	f := &SyslogFormatter{Facility: SyslogAuth, Hostname: "host", AppName: "my app", ProcID: "123"}
+
+	tests := []struct {
+		modify   func(f *SyslogFormatter)
+		expected string
+	}{
+		{
+			func(f *SyslogFormatter) {},
+			`<35>1 2014-01-02T03:04:05.678901Z host my_app 123 - [fields@32473 user_id="5" event="login" reason="bad \"password\"\]"] Login failed`,
+		},
+		{
+			func(f *SyslogFormatter) { f.MsgIDField, f.SDID = "event", "app@1234" },
+			`<35>1 2014-01-02T03:04:05.678901Z host my_app 123 login [app@1234 user_id="5" reason="bad \"password\"\]"] Login failed`,
+		},
+		{
+			func(f *SyslogFormatter) { f.Protocol, f.Hostname = RFC3164, "" },
+			`<35>Jan  2 03:04:05 my_app[123]: Login failed user_id=5 event=login reason="bad \"password\"]"`,
+		},
+	}
+
+	for i, test := range tests {
+		f := *f
+		test.modify(&f)
+		if str := f.Format(e); str != test.expected {
+			t.Errorf("test %d: Bad result:\n%s\n%s", i, str, test.expected)
+		}
+	}
+
+	e.Level, e.Fields = DEBUG, nil
+	if str := f.Format(e); str != "<39>1 2014-01-02T03:04:05.678901Z host my_app 123 - - Login failed" {
+		t.Errorf("Bad result: %s", str)
+	}
+	// Unknown levels must not be sent as Emergency (0).
+	e.Level = FATAL + 1
+	if str := f.Format(e); !strings.HasPrefix(str, "<33>") {
+		t.Errorf("Bad result: %s", str)
+	}
+}
+
+func TestSyslogWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	config := DefaultSyslogWriterConfig
+	config.Network, config.Address = "unixgram", path
+	w, err := NewSyslogWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := *w.config.Formatter.(*SyslogFormatter)
+	f.Hostname, f.AppName, f.ProcID = "host", "app", "1"
+	w.config.Formatter = &f
+	e := NewEntry(INFO, "A", Context{"b": 1})
+	w.Log(e)
+	w.Close()
+
+	buf := make([]byte, 256)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "<14>1 " + e.Time.Format("2006-01-02T15:04:05.000000Z07:00") + ` host app 1 - [fields@32473 b="1"] A`
+	if string(buf[:n]) != expected {
+		t.Errorf("Bad message:\n%s\n%s", buf[:n], expected)
+	}
+}